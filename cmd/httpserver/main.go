@@ -1,57 +1,75 @@
 package main
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
-	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/fileserver"
+	"github.com/AbdKaan/httpfromtcp/internal/proxy"
 	"github.com/AbdKaan/httpfromtcp/internal/request"
 	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/AbdKaan/httpfromtcp/internal/router"
 	"github.com/AbdKaan/httpfromtcp/internal/server"
 )
 
 const port = 42069
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	server, err := server.Serve(handler, port)
+	httpbin, err := proxy.New("https://httpbin.org")
+	if err != nil {
+		log.Fatalf("Error creating proxy: %v", err)
+	}
+	httpbin.StripPrefix = "/httpbin"
+
+	rt := router.New()
+	rt.Handle("", "/httpbin", httpbin.Serve)
+	rt.Handle("", "/httpbin/{path...}", httpbin.Serve)
+	rt.Handle("", "/yourproblem", handler400)
+	rt.Handle("", "/myproblem", handler500)
+	assets, err := fileserver.New("assets")
+	if err != nil {
+		log.Printf("Not serving assets: %v", err)
+	} else {
+		assets.StripPrefix = "/assets"
+		rt.Handle("", "/assets", assets.Serve)
+		rt.Handle("", "/assets/{path...}", assets.Serve)
+		rt.Handle("", "/video", func(w *response.Writer, req *request.Request) {
+			assets.ServeFile(w, req, "vim.mp4")
+		})
+	}
+	rt.NotFound = handler200
+
+	handler := server.Chain(
+		rt.Serve,
+		server.Logger(log.Default()),
+		server.Recoverer(),
+		server.Compress(server.DefaultCompressMinSize),
+	)
+	server, err := server.ListenAndServe(handler, fmt.Sprintf(":%d", port))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	log.Println("Server started on", server.Addr())
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		proxyHandler(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		handler400(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
-		handler500(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/video" {
-		handlerVideo(w, req)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	forced, err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Server stopped, %d connections forcibly closed: %v", forced, err)
 		return
 	}
-	handler200(w, req)
-	return
+	log.Println("Server gracefully stopped")
 }
 
 func handler400(w *response.Writer, _ *request.Request) {
@@ -67,7 +85,7 @@ func handler400(w *response.Writer, _ *request.Request) {
 </html>
 `)
 	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
+	h.Set("Content-Type", "text/html")
 	w.WriteHeaders(h)
 	w.WriteBody(body)
 	return
@@ -86,7 +104,7 @@ func handler500(w *response.Writer, _ *request.Request) {
 </html>
 `)
 	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
+	h.Set("Content-Type", "text/html")
 	w.WriteHeaders(h)
 	w.WriteBody(body)
 }
@@ -104,78 +122,8 @@ func handler200(w *response.Writer, _ *request.Request) {
 </html>
 `)
 	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
+	h.Set("Content-Type", "text/html")
 	w.WriteHeaders(h)
 	w.WriteBody(body)
 	return
 }
-
-func handlerVideo(w *response.Writer, req *request.Request) {
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	body, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		handler500(w, req)
-		return
-	}
-	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "video/mp4")
-	w.WriteHeaders(h)
-	w.WriteBody(body)
-	return
-}
-
-func proxyHandler(w *response.Writer, req *request.Request) {
-	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := "https://httpbin.org/" + target
-	fmt.Println("Proxying to", url)
-	resp, err := http.Get(url)
-	if err != nil {
-		handler500(w, req)
-		return
-	}
-	defer resp.Body.Close()
-
-	w.WriteStatusLine(response.StatusCodeSuccess)
-	h := response.GetDefaultHeaders(0)
-	h.Override("Transfer-Encoding", "chunked")
-	h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
-	h.Remove("Content-Length")
-	w.WriteHeaders(h)
-
-	const maxChunkSize = 1024
-	buffer := make([]byte, maxChunkSize)
-	fullBody := make([]byte, 0)
-	for {
-		n, err := resp.Body.Read(buffer)
-		fmt.Println("Read", n, "bytes")
-		if n > 0 {
-			_, err = w.WriteChunkedBody(buffer[:n])
-			if err != nil {
-				fmt.Println("Error writing chunked body:", err)
-				break
-			}
-			fullBody = append(fullBody, buffer[:n]...)
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-			break
-		}
-	}
-
-	_, err = w.WriteChunkedBodyDone()
-	if err != nil {
-		fmt.Println("Error writing chunked body done:", err)
-	}
-	trailers := headers.NewHeaders()
-	hashedBody := fmt.Sprintf("%x", sha256.Sum256(fullBody))
-	trailers.Set("X-Content-SHA256", hashedBody)
-	trailers.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
-	err = w.WriteTrailers(trailers)
-	if err != nil {
-		fmt.Println(err)
-	}
-	fmt.Println("Wrote trailers")
-}
@@ -35,7 +35,7 @@ func main() {
 		fmt.Printf("- Version: %s\n", r.RequestLine.HttpVersion)
 
 		fmt.Println("Headers:")
-		for key, value := range r.Headers {
+		for key, value := range r.Headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
 
@@ -0,0 +1,55 @@
+// Package chunked holds the pieces of the chunked transfer coding shared by
+// the request and response parsers.
+package chunked
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IsChunked reports whether chunked is the only transfer coding, which is
+// the only case the parsers know how to decode.
+func IsChunked(transferEncoding string) bool {
+	codings := strings.Split(transferEncoding, ",")
+	if len(codings) != 1 {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(codings[0]), "chunked")
+}
+
+// ParseSize parses the chunk-size line at the start of data. It returns the
+// chunk size and the number of bytes consumed, or 0 consumed if the line is
+// not complete yet.
+func ParseSize(data []byte) (int, int, error) {
+	// chunk      = chunk-size [ chunk-ext ] CRLF
+	//              chunk-data CRLF
+	// chunk-size = 1*HEXDIG
+	// chunk-ext  = *( BWS ";" BWS chunk-ext-name [ BWS "=" BWS chunk-ext-val ] )
+
+	// Example:
+	// 1a;name=value
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx == -1 {
+		return 0, 0, nil
+	}
+	line := data[:idx]
+	// Chunk extensions carry nothing we use, skip them
+	if i := bytes.IndexByte(line, ';'); i != -1 {
+		line = line[:i]
+	}
+	sizeText := string(bytes.TrimRight(line, " \t"))
+	if sizeText == "" {
+		return 0, 0, fmt.Errorf("missing chunk size")
+	}
+	if strings.TrimLeft(sizeText, "0123456789abcdefABCDEF") != "" {
+		return 0, 0, fmt.Errorf("malformed chunk size: %s", sizeText)
+	}
+	chunkSize, err := strconv.ParseInt(sizeText, 16, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed chunk size: %s", sizeText)
+	}
+	// Returns number of bytes it consumed
+	return int(chunkSize), idx + 2, nil
+}
@@ -0,0 +1,209 @@
+// Package client speaks HTTP/1.1 to servers with the same header model and
+// parsing approach the server side uses.
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultIdleTimeout         = 90 * time.Second
+	defaultMaxIdleConnsPerHost = 2
+)
+
+// Client sends requests and keeps finished connections open for reuse.
+type Client struct {
+	DialTimeout time.Duration
+	// IdleTimeout is how long an unused connection is kept in the pool
+	IdleTimeout time.Duration
+	// MaxIdleConnsPerHost limits how many unused connections are kept for
+	// each scheme, host and port
+	MaxIdleConnsPerHost int
+	// TLSConfig is used for https URLs, ServerName defaults to the URL host
+	TLSConfig *tls.Config
+	// ResponseHeaderTimeout limits the time from sending a request until
+	// its response headers are read, zero means no limit
+	ResponseHeaderTimeout time.Duration
+	// ResponseLimits bounds the size of the responses read, New sets it to
+	// response.DefaultLimits
+	ResponseLimits response.Limits
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+func New() *Client {
+	return &Client{
+		DialTimeout:         defaultDialTimeout,
+		IdleTimeout:         defaultIdleTimeout,
+		MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		ResponseLimits:      response.DefaultLimits,
+	}
+}
+
+// conn is a connection to a server together with the reader holding the
+// bytes read from it that were not parsed yet.
+type conn struct {
+	net.Conn
+	reader    *response.Reader
+	key       string
+	idleSince time.Time
+}
+
+func (c *Client) Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends the request and reads the response status line and headers. The
+// body is left on the connection to be read through Response.Body.
+func (c *Client) Do(req *Request) (*Response, error) {
+	for {
+		cn, reused, err := c.getConn(req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.roundTrip(cn, req)
+		if err == nil {
+			return resp, nil
+		}
+		cn.Close()
+		// The server may have closed an idle connection just as we picked
+		// it, try again on a fresh one if the request can be sent again
+		// without repeating a side effect
+		if reused && cn.reader.Buffered() == 0 && req.ContentLength == 0 && req.Idempotent() {
+			continue
+		}
+		return nil, err
+	}
+}
+
+func (c *Client) roundTrip(cn *conn, req *Request) (*Response, error) {
+	if c.ResponseHeaderTimeout > 0 {
+		cn.SetDeadline(time.Now().Add(c.ResponseHeaderTimeout))
+		defer cn.SetDeadline(time.Time{})
+	}
+	if err := req.write(cn); err != nil {
+		return nil, err
+	}
+	for {
+		parsed, err := cn.reader.ReadResponse(req.Method)
+		if err != nil {
+			return nil, err
+		}
+		// Interim responses such as 100 Continue are followed by the final one
+		if parsed.StatusCode < 200 && parsed.StatusCode != response.StatusCodeSwitchingProtocols {
+			continue
+		}
+
+		return &Response{
+			HttpVersion:  parsed.HttpVersion,
+			StatusCode:   parsed.StatusCode,
+			ReasonPhrase: parsed.ReasonPhrase,
+			Headers:      parsed.Headers,
+			Trailers:     parsed.Trailers,
+			Body: &body{
+				parsed:    parsed,
+				reader:    parsed.BodyReader(),
+				conn:      cn,
+				client:    c,
+				keepAlive: req.KeepAlive(),
+			},
+		}, nil
+	}
+}
+
+func (c *Client) getConn(req *Request) (*conn, bool, error) {
+	key := req.URL.Scheme + "://" + req.address()
+	if cn := c.popIdle(key); cn != nil {
+		return cn, true, nil
+	}
+
+	dialer := net.Dialer{Timeout: c.DialTimeout}
+	netConn, err := dialer.Dial("tcp", req.address())
+	if err != nil {
+		return nil, false, fmt.Errorf("error connecting to %s: %w", req.address(), err)
+	}
+	if req.URL.Scheme == "https" {
+		config := &tls.Config{}
+		if c.TLSConfig != nil {
+			config = c.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = req.URL.Hostname()
+		}
+		tlsConn := tls.Client(netConn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			netConn.Close()
+			return nil, false, fmt.Errorf("TLS handshake with %s failed: %w", req.address(), err)
+		}
+		netConn = tlsConn
+	}
+	reader := response.NewReader(netConn)
+	reader.Limits = c.ResponseLimits
+	return &conn{
+		Conn:   netConn,
+		reader: reader,
+		key:    key,
+	}, false, nil
+}
+
+func (c *Client) popIdle(key string) *conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		conns := c.idle[key]
+		if len(conns) == 0 {
+			return nil
+		}
+		cn := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		if c.IdleTimeout > 0 && time.Since(cn.idleSince) > c.IdleTimeout {
+			cn.Close()
+			continue
+		}
+		return cn
+	}
+}
+
+// release puts the connection back in the pool once a response has been
+// read, or closes it if it cannot be reused.
+func (c *Client) release(cn *conn, keepAlive bool) {
+	if !keepAlive || cn.reader.Buffered() > 0 {
+		cn.Close()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idle == nil {
+		c.idle = map[string][]*conn{}
+	}
+	if len(c.idle[cn.key]) >= c.MaxIdleConnsPerHost {
+		cn.Close()
+		return
+	}
+	cn.idleSince = time.Now()
+	c.idle[cn.key] = append(c.idle[cn.key], cn)
+}
+
+// CloseIdleConnections closes every pooled connection.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conns := range c.idle {
+		for _, cn := range conns {
+			cn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers every request on a connection with the response that
+// respond returns for it and counts accepted connections.
+type fakeServer struct {
+	listener net.Listener
+	accepted atomic.Int32
+}
+
+func newFakeServer(t *testing.T, respond func(req *request.Request) string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				reader := request.NewReader(conn)
+				for {
+					req, err := reader.ReadRequest()
+					if err != nil {
+						return
+					}
+					if _, err := req.ReadBody(); err != nil {
+						return
+					}
+					out := respond(req)
+					conn.Write([]byte(out))
+					if strings.Contains(out, "Connection: close") {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) url(path string) string {
+	return "http://" + s.listener.Addr().String() + path
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeServer(t, func(req *request.Request) string {
+		switch req.RequestLine.RequestTarget {
+		case "/chunked":
+			return "HTTP/1.1 200 OK\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"Trailer: X-Content-Length\r\n" +
+				"\r\n" +
+				"6\r\nhello \r\n" +
+				"6;ext=1\r\nworld!\r\n" +
+				"0\r\n" +
+				"X-Content-Length: 12\r\n" +
+				"\r\n"
+		case "/echo":
+			return "HTTP/1.1 201 Created\r\n" +
+				"Content-Length: " + strconv.Itoa(len(req.Body)) + "\r\n" +
+				"X-Method: " + req.RequestLine.Method + "\r\n" +
+				"\r\n" + string(req.Body)
+		case "/close":
+			return "HTTP/1.1 200 OK\r\n" +
+				"Connection: close\r\n" +
+				"\r\n" +
+				"until close"
+		default:
+			head := "HTTP/1.1 404 Not Found\r\n" +
+				"Content-Length: 9\r\n" +
+				"Set-Cookie: a=1\r\n" +
+				"Set-Cookie: b=2\r\n" +
+				"\r\n"
+			if req.RequestLine.Method == "HEAD" {
+				return head
+			}
+			return head + "Not Found"
+		}
+	})
+	c := New()
+
+	// Test: Content-Length body and repeated headers
+	resp, err := c.Get(s.url("/missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 404, int(resp.StatusCode))
+	assert.Equal(t, "Not Found", resp.ReasonPhrase)
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.Headers.Values("Set-Cookie"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "Not Found", string(body))
+
+	// Test: Chunked body with trailers on the same connection
+	resp, err = c.Get(s.url("/chunked"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "hello world!", string(body))
+	value, _ := resp.Trailers.Get("X-Content-Length")
+	assert.Equal(t, "12", value)
+	assert.Equal(t, int32(1), s.accepted.Load())
+
+	// Test: Request body with known length
+	req, err := NewRequest("POST", s.url("/echo"), strings.NewReader("ping"))
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "ping", string(body))
+
+	// Test: Chunked request body
+	req, err = NewRequest("PUT", s.url("/echo"), io.MultiReader(strings.NewReader("pi"), strings.NewReader("ng")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), req.ContentLength)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "ping", string(body))
+	method, _ := resp.Headers.Get("X-Method")
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, int32(1), s.accepted.Load())
+
+	// Test: HEAD response has no body even with Content-Length
+	req, err = NewRequest("HEAD", s.url("/missing"), nil)
+	require.NoError(t, err)
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, body)
+	assert.Equal(t, int32(1), s.accepted.Load())
+
+	// Test: Body delimited by the connection closing
+	resp, err = c.Get(s.url("/close"))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "until close", string(body))
+
+	// Test: A new connection is opened after the server closed one
+	resp, err = c.Get(s.url("/missing"))
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, int32(2), s.accepted.Load())
+}
+
+func TestRetry(t *testing.T) {
+	// The server answers GET and drops the connection on anything else
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var posts atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := request.NewReader(conn)
+				for {
+					req, err := reader.ReadRequest()
+					if err != nil {
+						return
+					}
+					if req.RequestLine.Method != "GET" {
+						posts.Add(1)
+						return
+					}
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+				}
+			}()
+		}
+	}()
+	url := "http://" + listener.Addr().String() + "/"
+	c := New()
+
+	// Test: A POST on a reused connection that fails is not sent again
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	req, err := NewRequest("POST", url, nil)
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), posts.Load())
+}
+
+func TestResponseLimits(t *testing.T) {
+	s := newFakeServer(t, func(req *request.Request) string {
+		return "HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 64) + "\r\nContent-Length: 0\r\n\r\n"
+	})
+
+	// Test: Defaults allow ordinary responses
+	c := New()
+	resp, err := c.Get(s.url("/"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// Test: Responses over the client's limits fail
+	c.ResponseLimits.MaxHeaderFieldBytes = 32
+	c.CloseIdleConnections()
+	_, err = c.Get(s.url("/"))
+	require.ErrorIs(t, err, response.ErrHeaderFieldsTooLarge)
+}
+
+func TestNewRequest(t *testing.T) {
+	// Test: Unsupported scheme
+	_, err := NewRequest("GET", "ftp://localhost/", nil)
+	require.Error(t, err)
+
+	// Test: Missing host
+	_, err = NewRequest("GET", "http:///path", nil)
+	require.Error(t, err)
+
+	// Test: Default ports
+	req, err := NewRequest("GET", "https://example.com/a?b=c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:443", req.address())
+	assert.Equal(t, "/a?b=c", req.URL.RequestURI())
+}
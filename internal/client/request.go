@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/message"
+)
+
+// ErrRequestBody wraps errors from reading the request body, as opposed to
+// errors of the connection to the server.
+var ErrRequestBody = errors.New("error reading request body")
+
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers *headers.Headers
+	Body    io.Reader
+	// ContentLength is the length of Body. If it is -1 the length is unknown
+	// and the body is sent chunked.
+	ContentLength int64
+}
+
+// NewRequest builds a request for an http or https URL. The body length is
+// taken from bytes.Reader, bytes.Buffer and strings.Reader bodies, any other
+// body is sent chunked unless ContentLength is set.
+func NewRequest(method, rawURL string, body io.Reader) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %v", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in URL: %s", rawURL)
+	}
+
+	var contentLength int64
+	switch b := body.(type) {
+	case nil:
+		contentLength = 0
+	case *bytes.Reader:
+		contentLength = int64(b.Len())
+	case *bytes.Buffer:
+		contentLength = int64(b.Len())
+	case *strings.Reader:
+		contentLength = int64(b.Len())
+	default:
+		contentLength = -1
+	}
+
+	return &Request{
+		Method:        method,
+		URL:           u,
+		Headers:       headers.NewHeaders(),
+		Body:          body,
+		ContentLength: contentLength,
+	}, nil
+}
+
+// address returns the host:port to connect to.
+func (r *Request) address() string {
+	port := r.URL.Port()
+	if port == "" {
+		port = "80"
+		if r.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return r.URL.Hostname() + ":" + port
+}
+
+// Idempotent reports whether sending the request twice has the same effect
+// as sending it once, so it can be sent again after a connection error.
+func (r *Request) Idempotent() bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// KeepAlive reports whether the request lets the connection be reused.
+func (r *Request) KeepAlive() bool {
+	return message.KeepAlive("1.1", r.Headers)
+}
+
+func (r *Request) write(w io.Writer) error {
+	// request-line = method SP request-target SP HTTP-version
+	head := fmt.Appendf(nil, "%s %s HTTP/1.1\r\n", r.Method, r.URL.RequestURI())
+
+	// The framing headers are ours to set, they have to match what is sent
+	h := r.Headers.Clone()
+	h.Del("Content-Length")
+	h.Del("Transfer-Encoding")
+	if _, ok := h.Get("host"); !ok {
+		head = fmt.Appendf(head, "Host: %s\r\n", r.URL.Host)
+	}
+	switch {
+	case r.ContentLength > 0:
+		h.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	case r.ContentLength < 0:
+		h.Set("Transfer-Encoding", "chunked")
+	case r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH":
+		h.Set("Content-Length", "0")
+	}
+	for key, value := range h.All() {
+		head = fmt.Appendf(head, "%s: %s\r\n", key, value)
+	}
+	head = append(head, "\r\n"...)
+	if _, err := w.Write(head); err != nil {
+		return fmt.Errorf("couldn't write request head: %w", err)
+	}
+
+	body := bodyReader{r.Body}
+	switch {
+	case r.ContentLength > 0:
+		n, err := io.CopyN(w, body, r.ContentLength)
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("%w: body shorter than Content-Length", ErrRequestBody)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't write request body after %d bytes: %w", n, err)
+		}
+	case r.ContentLength < 0:
+		if err := writeChunked(w, body); err != nil {
+			return fmt.Errorf("couldn't write chunked request body: %w", err)
+		}
+	}
+	return nil
+}
+
+func writeChunked(w io.Writer, body io.Reader) error {
+	const maxChunkSize = 32 << 10
+	buffer := make([]byte, maxChunkSize)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			chunk := fmt.Appendf(nil, "%x\r\n", n)
+			chunk = append(chunk, buffer[:n]...)
+			chunk = append(chunk, "\r\n"...)
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte("0\r\n\r\n"))
+	return err
+}
+
+// bodyReader marks the errors of reading the body with ErrRequestBody.
+type bodyReader struct {
+	reader io.Reader
+}
+
+func (b bodyReader) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", ErrRequestBody, err)
+	}
+	return n, err
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+type Response struct {
+	HttpVersion  string
+	StatusCode   response.StatusCode
+	ReasonPhrase string
+	Headers      *headers.Headers
+	// Trailers holds the trailer fields sent after a chunked body, they are
+	// only complete once Body has been read to the end.
+	Trailers *headers.Headers
+	// Body streams the response body from the connection. It must be closed
+	// for the connection to be reused.
+	Body io.ReadCloser
+}
+
+// body streams the body of a response from its connection and hands the
+// connection back to the client once the body is complete.
+type body struct {
+	parsed *response.Response
+	reader io.Reader
+	conn   *conn
+	client *Client
+	// keepAlive is false when the request asked for the connection to be
+	// closed
+	keepAlive bool
+	err       error
+	closed    bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.reader.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+		b.closed = true
+		b.conn.Close()
+		return n, err
+	}
+	if b.parsed.Done() {
+		b.release()
+	}
+	return n, err
+}
+
+// Close hands the connection back if the body was read completely and
+// closes it otherwise.
+func (b *body) Close() error {
+	if !b.parsed.Done() {
+		b.err = fmt.Errorf("read on closed response body")
+		if !b.closed {
+			b.closed = true
+			return b.conn.Close()
+		}
+		return nil
+	}
+	b.release()
+	return nil
+}
+
+func (b *body) release() {
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.client.release(b.conn, b.keepAlive && b.parsed.KeepAlive())
+}
@@ -0,0 +1,198 @@
+package cookie
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cookie is an HTTP cookie as described by RFC 6265. Requests carry only
+// Name and Value, the other fields are attributes of a Set-Cookie response
+// header.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. 0 leaves the attribute out and a
+	// negative value deletes the cookie right away, as Max-Age=0.
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSite
+	// Partitioned keeps the cookie to the top-level site it was set under
+	// (CHIPS). It requires Secure.
+	Partitioned bool
+}
+
+// SameSite controls whether a cookie is sent with cross-site requests. The
+// zero value leaves the attribute out.
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+func (s SameSite) String() string {
+	switch s {
+	case SameSiteLax:
+		return "Lax"
+	case SameSiteStrict:
+		return "Strict"
+	case SameSiteNone:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+// expiresFormat is the IMF-fixdate format of HTTP dates
+const expiresFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// HeaderValue returns the cookie as the value of a Set-Cookie header, or an
+// error if a browser could not store it as given.
+func (c *Cookie) HeaderValue() (string, error) {
+	if !isToken(c.Name) {
+		return "", fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	if !validValue(c.Value) {
+		return "", fmt.Errorf("invalid value for cookie %s", c.Name)
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		if !validPath(c.Path) {
+			return "", fmt.Errorf("invalid path for cookie %s: %q", c.Name, c.Path)
+		}
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Domain != "" {
+		domain := strings.TrimPrefix(c.Domain, ".")
+		if !validDomain(domain) {
+			return "", fmt.Errorf("invalid domain for cookie %s: %q", c.Name, c.Domain)
+		}
+		b.WriteString("; Domain=")
+		b.WriteString(domain)
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(expiresFormat))
+	}
+	if c.MaxAge != 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(max(c.MaxAge, 0)))
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != SameSiteDefault {
+		// Browsers reject SameSite=None without Secure
+		if c.SameSite == SameSiteNone && !c.Secure {
+			return "", fmt.Errorf("cookie %s has SameSite=None without Secure", c.Name)
+		}
+		b.WriteString("; SameSite=")
+		b.WriteString(c.SameSite.String())
+	}
+	if c.Partitioned {
+		if !c.Secure {
+			return "", fmt.Errorf("cookie %s is Partitioned without Secure", c.Name)
+		}
+		b.WriteString("; Partitioned")
+	}
+	return b.String(), nil
+}
+
+// Parse parses the value of a Cookie request header. Pairs that are not
+// valid cookies are skipped.
+func Parse(header string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !isToken(name) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !validValue(value) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// isToken checks token = 1*tchar from RFC 9110.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		isAlnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+		if !isAlnum && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// validValue checks the cookie-octets of RFC 6265: visible ASCII other than
+// DQUOTE, comma, semicolon and backslash.
+func validValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// validPath allows any visible ASCII other than semicolon.
+func validPath(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c >= 0x7f || c == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// validDomain accepts an IP address or a host name of letters, digits,
+// hyphens and dots.
+func validDomain(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	if net.ParseIP(s) != nil {
+		return !strings.Contains(s, ":")
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
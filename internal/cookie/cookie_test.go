@@ -0,0 +1,71 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderValue(t *testing.T) {
+	// Test: Every attribute
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Path:        "/app",
+		Domain:      ".example.com",
+		Expires:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	value, err := c.HeaderValue()
+	require.NoError(t, err)
+	assert.Equal(t, "session=abc123; Path=/app; Domain=example.com; Expires=Fri, 01 Mar 2024 11:00:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", value)
+
+	// Test: Only name and value
+	value, err = (&Cookie{Name: "theme", Value: ""}).HeaderValue()
+	require.NoError(t, err)
+	assert.Equal(t, "theme=", value)
+
+	// Test: Negative MaxAge deletes the cookie
+	value, err = (&Cookie{Name: "session", MaxAge: -1, SameSite: SameSiteLax}).HeaderValue()
+	require.NoError(t, err)
+	assert.Equal(t, "session=; Max-Age=0; SameSite=Lax", value)
+
+	// Test: Invalid cookies
+	for _, c := range []*Cookie{
+		{Name: "", Value: "v"},
+		{Name: "a b", Value: "v"},
+		{Name: "a", Value: "x;y"},
+		{Name: "a", Value: "caf\xc3\xa9"},
+		{Name: "a", Path: "/x;Domain=evil"},
+		{Name: "a", Domain: "exa mple.com"},
+		{Name: "a", Domain: "::1"},
+		{Name: "a", SameSite: SameSiteNone},
+		{Name: "a", Partitioned: true},
+	} {
+		_, err := c.HeaderValue()
+		assert.Error(t, err, "%+v", c)
+	}
+}
+
+func TestParse(t *testing.T) {
+	// Test: Several pairs with quoted values
+	cookies := Parse(`session=abc123; theme="dark";lang=en`)
+	require.Len(t, cookies, 3)
+	assert.Equal(t, Cookie{Name: "session", Value: "abc123"}, *cookies[0])
+	assert.Equal(t, Cookie{Name: "theme", Value: "dark"}, *cookies[1])
+	assert.Equal(t, Cookie{Name: "lang", Value: "en"}, *cookies[2])
+
+	// Test: Invalid pairs are skipped
+	cookies = Parse(`novalue; =empty; bad name=1; ok=1; q="a"b"; x=a,b`)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+
+	// Test: Empty header
+	assert.Empty(t, Parse(""))
+}
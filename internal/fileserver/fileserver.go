@@ -0,0 +1,344 @@
+// Package fileserver serves the files below a directory with support for
+// range and conditional requests.
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+// timeFormat is the IMF-fixdate format used by Last-Modified and the
+// If-*-Since headers
+const timeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+const indexFile = "index.html"
+
+// FileServer is a handler serving the files below Root.
+type FileServer struct {
+	// root only allows opening files below the directory, also through
+	// symlinks
+	root *os.Root
+	// StripPrefix is removed from the request path before it is looked up
+	StripPrefix string
+	// ListDirectories serves a listing for directories without an
+	// index.html, otherwise they are 404
+	ListDirectories bool
+}
+
+// New creates a file server for dir with directory listings enabled.
+func New(dir string) (*FileServer, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", dir, err)
+	}
+	return &FileServer{root: root, ListDirectories: true}, nil
+}
+
+// Close releases the root directory.
+func (s *FileServer) Close() error {
+	return s.root.Close()
+}
+
+// Serve is a server.Handler serving the file named by the request path.
+func (s *FileServer) Serve(w *response.Writer, req *request.Request) {
+	if !allowedMethod(w, req) {
+		return
+	}
+	requestPath := req.Target.RawPath
+	rawPath := strings.TrimPrefix(requestPath, s.StripPrefix)
+	name, err := url.PathUnescape(rawPath)
+	if err != nil || strings.ContainsRune(name, 0) {
+		writeError(w, response.StatusCodeBadRequest)
+		return
+	}
+	// Rooting the path before cleaning it keeps ".." from climbing above
+	// the root, which os.Root enforces again for symlinks
+	name = path.Clean("/" + name)
+
+	info, err := s.root.Stat(rel(name))
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(rawPath, "/") {
+			redirect(w, req, path.Base(requestPath)+"/")
+			return
+		}
+		index := path.Join(name, indexFile)
+		if _, err := s.root.Stat(rel(index)); err == nil {
+			s.serveFile(w, req, index)
+			return
+		}
+		if !s.ListDirectories {
+			writeError(w, response.StatusCodeNotFound)
+			return
+		}
+		s.serveListing(w, req, name)
+		return
+	}
+	if strings.HasSuffix(rawPath, "/") {
+		writeError(w, response.StatusCodeNotFound)
+		return
+	}
+	s.serveFile(w, req, name)
+}
+
+// ServeFile serves the named file below the root regardless of the request
+// path.
+func (s *FileServer) ServeFile(w *response.Writer, req *request.Request, name string) {
+	if !allowedMethod(w, req) {
+		return
+	}
+	s.serveFile(w, req, path.Clean("/"+name))
+}
+
+func (s *FileServer) serveFile(w *response.Writer, req *request.Request, name string) {
+	f, err := s.root.Open(rel(name))
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	if info.IsDir() {
+		writeError(w, response.StatusCodeNotFound)
+		return
+	}
+
+	size := info.Size()
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), size)
+
+	h := headers.NewHeaders()
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("ETag", etag)
+	if !modTime.IsZero() && modTime.Unix() > 0 {
+		h.Set("Last-Modified", modTime.Format(timeFormat))
+	}
+
+	switch checkConditions(req, etag, modTime) {
+	case conditionFailed:
+		writeStatus(w, response.StatusCodePreconditionFailed, h)
+		return
+	case conditionNotModified:
+		writeStatus(w, response.StatusCodeNotModified, h)
+		return
+	}
+
+	contentType, err := contentType(f, name)
+	if err != nil {
+		log.Printf("fileserver: error reading %s: %v", name, err)
+		writeError(w, response.StatusCodeInternalServerError)
+		return
+	}
+
+	var ranges []byteRange
+	if rangeHeader, ok := req.Headers.Get("range"); ok && ifRangeMatches(req, etag, modTime) {
+		ranges, err = parseRange(rangeHeader, size)
+		if errors.Is(err, errUnsatisfiableRange) {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeStatus(w, response.StatusCodeRangeNotSatisfiable, h)
+			return
+		}
+		// A Range header we cannot make sense of is ignored
+		if err != nil {
+			ranges = nil
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(h)
+		if req.RequestLine.Method != "HEAD" {
+			copyRange(w, f, byteRange{start: 0, length: size}, name)
+		}
+	case 1:
+		r := ranges[0]
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Range", r.contentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(r.length, 10))
+		w.WriteStatusLine(response.StatusCodePartialContent)
+		w.WriteHeaders(h)
+		if req.RequestLine.Method != "HEAD" {
+			copyRange(w, f, r, name)
+		}
+	default:
+		parts := newMultipartRanges(ranges, contentType, size)
+		h.Set("Content-Type", "multipart/byteranges; boundary="+parts.boundary)
+		h.Set("Content-Length", strconv.FormatInt(parts.length(), 10))
+		w.WriteStatusLine(response.StatusCodePartialContent)
+		w.WriteHeaders(h)
+		if req.RequestLine.Method != "HEAD" {
+			for i, r := range ranges {
+				w.WriteBody([]byte(parts.partHeader(i)))
+				if !copyRange(w, f, r, name) {
+					return
+				}
+			}
+			w.WriteBody([]byte(parts.closing()))
+		}
+	}
+}
+
+func (s *FileServer) serveListing(w *response.Writer, req *request.Request, name string) {
+	dir, err := s.root.Open(rel(name))
+	if err != nil {
+		writeOpenError(w, err)
+		return
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		log.Printf("fileserver: error listing %s: %v", name, err)
+		writeError(w, response.StatusCodeInternalServerError)
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var b strings.Builder
+	title := html.EscapeString(name)
+	fmt.Fprintf(&b, "<html>\n<head>\n<title>Index of %s</title>\n</head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if name != "/" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := (&url.URL{Path: entryName}).EscapedPath()
+		// A name with a colon would otherwise be read as a URL scheme
+		if strings.Contains(entryName, ":") {
+			href = "./" + href
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	body := []byte(b.String())
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteStatusLine(response.StatusCodeSuccess)
+	w.WriteHeaders(h)
+	if req.RequestLine.Method != "HEAD" {
+		w.WriteBody(body)
+	}
+}
+
+// rel turns a cleaned request path into a name os.Root accepts.
+func rel(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// copyRange streams a range of the file to the body and reports whether it
+// was written completely.
+func copyRange(w *response.Writer, f *os.File, r byteRange, name string) bool {
+	_, err := io.Copy(w, io.NewSectionReader(f, r.start, r.length))
+	if err != nil {
+		log.Printf("fileserver: error sending %s: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// contentType infers the type from the extension and falls back to
+// sniffing the start of the file.
+func contentType(f *os.File, name string) (string, error) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType, nil
+	}
+	buf := make([]byte, sniffLen)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return sniff(buf[:n]), nil
+}
+
+func allowedMethod(w *response.Writer, req *request.Request) bool {
+	if req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD" {
+		return true
+	}
+	body := []byte(response.StatusText(response.StatusCodeMethodNotAllowed) + "\n")
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Allow", "GET, HEAD")
+	w.WriteStatusLine(response.StatusCodeMethodNotAllowed)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+	return false
+}
+
+// redirect sends the client to location, an escaped path relative to the
+// request path, keeping the query.
+func redirect(w *response.Writer, req *request.Request, location string) {
+	if req.Target.RawQuery != "" {
+		location += "?" + req.Target.RawQuery
+	}
+	h := response.GetDefaultHeaders(0)
+	h.Set("Location", location)
+	w.WriteStatusLine(response.StatusCodeMovedPermanently)
+	w.WriteHeaders(h)
+}
+
+func writeOpenError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, response.StatusCodeNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, response.StatusCodeForbidden)
+	case errors.As(err, new(*fs.PathError)):
+		// The path cannot be opened, such as a symlink os.Root refuses to
+		// follow out of the root or a file used as a directory
+		writeError(w, response.StatusCodeNotFound)
+	default:
+		log.Printf("fileserver: %v", err)
+		writeError(w, response.StatusCodeInternalServerError)
+	}
+}
+
+// writeStatus writes a response without a body, such as 304 or 416.
+func writeStatus(w *response.Writer, statusCode response.StatusCode, h *headers.Headers) {
+	// A 304 has no body by definition, a Content-Length would describe the
+	// file instead
+	if statusCode != response.StatusCodeNotModified {
+		h.Set("Content-Length", "0")
+	}
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode) {
+	body := []byte(response.StatusText(statusCode) + "\n")
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
@@ -0,0 +1,190 @@
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*FileServer, string) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data"), []byte("\x89PNG\r\n\x1a\nrest"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a <b>.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<html></html>"), 0o644))
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "hello.txt"), modTime, modTime))
+
+	s, err := New(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, dir
+}
+
+func get(t *testing.T, s *FileServer, method, target string, extra ...string) *response.Response {
+	raw := method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n"
+	for _, field := range extra {
+		raw += field + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	s.Serve(response.NewWriter(buf), req)
+	resp, err := response.NewReader(buf).ReadResponse(method)
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	return resp
+}
+
+func header(resp *response.Response, key string) string {
+	value, _ := resp.Headers.Get(key)
+	return value
+}
+
+func TestServeFile(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Test: Whole file with type from the extension and validators
+	resp := get(t, s, "GET", "/hello.txt")
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Equal(t, "hello world", string(resp.Body))
+	assert.Equal(t, "text/plain; charset=utf-8", header(resp, "Content-Type"))
+	assert.Equal(t, "11", header(resp, "Content-Length"))
+	assert.Equal(t, "bytes", header(resp, "Accept-Ranges"))
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", header(resp, "Last-Modified"))
+	etag := header(resp, "ETag")
+	assert.NotEmpty(t, etag)
+
+	// Test: Type sniffed from the content
+	resp = get(t, s, "GET", "/data")
+	assert.Equal(t, "image/png", header(resp, "Content-Type"))
+
+	// Test: HEAD sends the headers only
+	resp = get(t, s, "HEAD", "/hello.txt")
+	assert.Equal(t, "11", header(resp, "Content-Length"))
+	assert.Empty(t, resp.Body)
+
+	// Test: Conditional requests
+	resp = get(t, s, "GET", "/hello.txt", "If-None-Match: W/"+etag)
+	assert.Equal(t, response.StatusCodeNotModified, resp.StatusCode)
+	assert.Empty(t, header(resp, "Content-Length"))
+	resp = get(t, s, "GET", "/hello.txt", `If-None-Match: "other"`)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	resp = get(t, s, "GET", "/hello.txt", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCodeNotModified, resp.StatusCode)
+	resp = get(t, s, "GET", "/hello.txt", "If-Modified-Since: Thu, 29 Feb 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	resp = get(t, s, "GET", "/hello.txt", `If-Match: "other"`)
+	assert.Equal(t, response.StatusCodePreconditionFailed, resp.StatusCode)
+
+	// Test: Other methods are not allowed
+	resp = get(t, s, "POST", "/hello.txt")
+	assert.Equal(t, response.StatusCodeMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD", header(resp, "Allow"))
+}
+
+func TestServeRange(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// Test: Single range
+	resp := get(t, s, "GET", "/hello.txt", "Range: bytes=6-")
+	assert.Equal(t, response.StatusCodePartialContent, resp.StatusCode)
+	assert.Equal(t, "world", string(resp.Body))
+	assert.Equal(t, "bytes 6-10/11", header(resp, "Content-Range"))
+
+	// Test: Suffix range longer than the file
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=-100")
+	assert.Equal(t, response.StatusCodePartialContent, resp.StatusCode)
+	assert.Equal(t, "hello world", string(resp.Body))
+
+	// Test: Multiple ranges
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=0-1, -3")
+	assert.Equal(t, response.StatusCodePartialContent, resp.StatusCode)
+	contentType := header(resp, "Content-Type")
+	require.True(t, strings.HasPrefix(contentType, "multipart/byteranges; boundary="))
+	boundary := strings.TrimPrefix(contentType, "multipart/byteranges; boundary=")
+	assert.Equal(t, "--"+boundary+"\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Range: bytes 0-1/11\r\n\r\n"+
+		"he\r\n"+
+		"--"+boundary+"\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Range: bytes 8-10/11\r\n\r\n"+
+		"rld\r\n"+
+		"--"+boundary+"--\r\n", string(resp.Body))
+
+	// Test: Unsatisfiable range
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=20-30")
+	assert.Equal(t, response.StatusCodeRangeNotSatisfiable, resp.StatusCode)
+	assert.Equal(t, "bytes */11", header(resp, "Content-Range"))
+
+	// Test: Malformed range is ignored
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=5-2")
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Equal(t, "hello world", string(resp.Body))
+
+	// Test: If-Range with an outdated validator sends the whole file
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=0-4", `If-Range: "outdated"`)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	resp = get(t, s, "GET", "/hello.txt", "Range: bytes=0-4", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.StatusCodePartialContent, resp.StatusCode)
+	assert.Equal(t, "hello", string(resp.Body))
+}
+
+func TestServeDirectory(t *testing.T) {
+	s, dir := newTestServer(t)
+
+	// Test: Listing escapes names
+	resp := get(t, s, "GET", "/sub/")
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Contains(t, string(resp.Body), `<a href="a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a>`)
+
+	// Test: Directory without a trailing slash is redirected
+	resp = get(t, s, "GET", "/sub?x=1")
+	assert.Equal(t, response.StatusCodeMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "sub/?x=1", header(resp, "Location"))
+
+	// Test: index.html is served for its directory
+	resp = get(t, s, "GET", "/site/")
+	assert.Equal(t, "<html></html>", string(resp.Body))
+	assert.Equal(t, "text/html; charset=utf-8", header(resp, "Content-Type"))
+
+	// Test: Listings can be turned off
+	s.ListDirectories = false
+	resp = get(t, s, "GET", "/sub/")
+	assert.Equal(t, response.StatusCodeNotFound, resp.StatusCode)
+
+	// Test: Paths cannot leave the root
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(dir), "secret"), []byte("secret"), 0o644))
+	for _, target := range []string{"/../secret", "/%2e%2e/secret", "/sub/..%2f..%2fsecret"} {
+		resp = get(t, s, "GET", target)
+		assert.Equal(t, response.StatusCodeNotFound, resp.StatusCode, target)
+	}
+	require.NoError(t, os.Symlink(filepath.Join(filepath.Dir(dir), "secret"), filepath.Join(dir, "link")))
+	resp = get(t, s, "GET", "/link")
+	assert.Equal(t, response.StatusCodeNotFound, resp.StatusCode)
+
+	// Test: A file used as a directory is not found
+	resp = get(t, s, "GET", "/hello.txt/x")
+	assert.Equal(t, response.StatusCodeNotFound, resp.StatusCode)
+
+	// Test: Prefix is stripped
+	s.StripPrefix = "/static"
+	resp = get(t, s, "GET", "/static/hello.txt")
+	assert.Equal(t, "hello world", string(resp.Body))
+	resp = get(t, s, "GET", "/static")
+	assert.Equal(t, "static/", header(resp, "Location"))
+}
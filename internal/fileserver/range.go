@@ -0,0 +1,224 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+)
+
+// maxRanges limits the ranges served for one request, a request for more is
+// answered with the whole file
+const maxRanges = 32
+
+var (
+	errUnsatisfiableRange = errors.New("range not satisfiable")
+	errInvalidRange       = errors.New("invalid range")
+)
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header for a file of the given size. Ranges that
+// start past the end are left out, if none is left errUnsatisfiableRange is
+// returned.
+func parseRange(value string, size int64) ([]byteRange, error) {
+	// Range = ranges-specifier = range-unit "=" range-set
+	unit, set, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, errInvalidRange
+	}
+	specs := strings.Split(set, ",")
+	if len(specs) > maxRanges {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		var r byteRange
+		if first == "" {
+			// suffix-range = "-" suffix-length
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			r = byteRange{start: size - n, length: n}
+		} else {
+			// int-range = first-pos "-" [ last-pos ]
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errInvalidRange
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// multipartRanges builds the framing of a multipart/byteranges body.
+type multipartRanges struct {
+	boundary    string
+	ranges      []byteRange
+	contentType string
+	size        int64
+}
+
+func newMultipartRanges(ranges []byteRange, contentType string, size int64) *multipartRanges {
+	return &multipartRanges{
+		boundary:    randomBoundary(),
+		ranges:      ranges,
+		contentType: contentType,
+		size:        size,
+	}
+}
+
+func randomBoundary() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// partHeader is written before the data of range i and ends the previous
+// part.
+func (m *multipartRanges) partHeader(i int) string {
+	var b strings.Builder
+	if i > 0 {
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s\r\n", m.boundary)
+	fmt.Fprintf(&b, "Content-Type: %s\r\n", m.contentType)
+	fmt.Fprintf(&b, "Content-Range: %s\r\n\r\n", m.ranges[i].contentRange(m.size))
+	return b.String()
+}
+
+func (m *multipartRanges) closing() string {
+	return "\r\n--" + m.boundary + "--\r\n"
+}
+
+// length is the size of the whole body, so it can be sent with a
+// Content-Length.
+func (m *multipartRanges) length() int64 {
+	n := int64(len(m.closing()))
+	for i, r := range m.ranges {
+		n += int64(len(m.partHeader(i))) + r.length
+	}
+	return n
+}
+
+type condition int
+
+const (
+	conditionNone condition = iota
+	conditionFailed
+	conditionNotModified
+)
+
+// checkConditions evaluates the conditional headers in the order RFC 9110
+// section 13.2.2 gives.
+func checkConditions(req *request.Request, etag string, modTime time.Time) condition {
+	if ifMatch, ok := req.Headers.Get("if-match"); ok {
+		if !etagMatches(ifMatch, etag, false) {
+			return conditionFailed
+		}
+	} else if since, ok := parseTime(req, "if-unmodified-since"); ok && modTime.After(since) {
+		return conditionFailed
+	}
+
+	if ifNoneMatch, ok := req.Headers.Get("if-none-match"); ok {
+		if etagMatches(ifNoneMatch, etag, true) {
+			if req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD" {
+				return conditionNotModified
+			}
+			return conditionFailed
+		}
+	} else if since, ok := parseTime(req, "if-modified-since"); ok && !modTime.After(since) {
+		return conditionNotModified
+	}
+	return conditionNone
+}
+
+// ifRangeMatches reports whether a Range header applies, which it only does
+// if an If-Range header names the current version of the file.
+func ifRangeMatches(req *request.Request, etag string, modTime time.Time) bool {
+	ifRange, ok := req.Headers.Get("if-range")
+	if !ok {
+		return true
+	}
+	ifRange = strings.TrimSpace(ifRange)
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etagMatches(ifRange, etag, false)
+	}
+	t, err := time.Parse(timeFormat, ifRange)
+	return err == nil && t.Equal(modTime)
+}
+
+// etagMatches compares etag against a list of entity tags. Weak comparison
+// ignores the W/ prefix, strong comparison never matches a weak tag.
+func etagMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if isWeak := strings.HasPrefix(candidate, "W/"); isWeak {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTime(req *request.Request, name string) (time.Time, bool) {
+	value, ok := req.Headers.Get(name)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeFormat, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,81 @@
+package fileserver
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of a file is looked at to guess its type
+const sniffLen = 512
+
+// signature is a byte pattern at a fixed offset that identifies a type.
+type signature struct {
+	offset      int
+	prefix      []byte
+	contentType string
+}
+
+var signatures = []signature{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("OggS"), "application/ogg"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/x-gzip"},
+	{0, []byte("\x00asm"), "application/wasm"},
+}
+
+// htmlPrefixes mark a text file as HTML when it starts with one of them,
+// compared case-insensitively after leading whitespace
+var htmlPrefixes = [][]byte{
+	[]byte("<!doctype html"),
+	[]byte("<html"),
+	[]byte("<head"),
+	[]byte("<body"),
+	[]byte("<!--"),
+}
+
+// sniff guesses the content type of data, which is the start of a file.
+func sniff(data []byte) string {
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.prefix) &&
+			bytes.Equal(data[sig.offset:sig.offset+len(sig.prefix)], sig.prefix) {
+			return sig.contentType
+		}
+	}
+	if !isText(data) {
+		return "application/octet-stream"
+	}
+	trimmed := bytes.TrimLeft(data, " \t\r\n\f")
+	for _, prefix := range htmlPrefixes {
+		if len(trimmed) >= len(prefix) && bytes.EqualFold(trimmed[:len(prefix)], prefix) {
+			return "text/html; charset=utf-8"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// isText reports whether data is UTF-8 without control characters other
+// than whitespace. A rune cut off at the end of data is allowed.
+func isText(data []byte) bool {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			if len(data)-i < utf8.UTFMax && !utf8.FullRune(data[i:]) {
+				return true
+			}
+			return false
+		}
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' || r == 0x7f {
+			return false
+		}
+		i += size
+	}
+	return true
+}
@@ -3,18 +3,30 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"iter"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers is an ordered list of header fields. Every field line is kept on
+// its own with the name as it was given, so repeated fields such as
+// Set-Cookie survive and headers are written back in the order they were
+// added. Lookups by name are case-insensitive.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name  string
+	value string
+}
 
-func NewHeaders() Headers {
-	return map[string]string{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 const crlf = "\r\n"
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	idx := bytes.Index(data, []byte(crlf))
 	if idx == -1 {
 		return 0, false, nil
@@ -26,6 +38,9 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
+	if len(parts) != 2 {
+		return 0, false, fmt.Errorf("missing colon in header: %s", data[:idx])
+	}
 	key := string(parts[0])
 
 	if key != strings.TrimRight(key, " ") {
@@ -40,49 +55,109 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 0, false, fmt.Errorf("invalid character in key: %v", key)
 	}
 
-	// key needs to be lower case
-	key = strings.ToLower(key)
+	h.Add(key, string(value))
+
+	return idx + 2, false, nil
+}
 
-	if val, ok := h[key]; ok {
-		h[key] = fmt.Sprintf("%s, %s", val, value)
-	} else {
-		h.Set(key, string(value))
+// Get returns the values of all fields named key joined with ", ", which is
+// how repeated fields are combined for most headers. Cookie fields are
+// joined with "; " instead. Set-Cookie values cannot be combined at all and
+// must be read with Values.
+func (h *Headers) Get(key string) (string, bool) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return "", false
 	}
+	if strings.EqualFold(key, "cookie") {
+		return strings.Join(values, "; "), true
+	}
+	return strings.Join(values, ", "), true
+}
 
-	return idx + 2, false, nil
+// Values returns the value of every field named key in order.
+func (h *Headers) Values(key string) []string {
+	if h == nil {
+		return nil
+	}
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			values = append(values, f.value)
+		}
+	}
+	return values
+}
+
+// Add appends a field, keeping any existing fields with the same name.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, field{name: key, value: value})
+}
+
+// Set replaces all fields named key with a single one. It keeps the position
+// of the first field that is replaced.
+func (h *Headers) Set(key, value string) {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			h.fields[i] = field{name: key, value: value}
+			h.fields = append(h.fields[:i+1], deleteFields(h.fields[i+1:], key)...)
+			return
+		}
+	}
+	h.Add(key, value)
+}
+
+// Del removes all fields named key.
+func (h *Headers) Del(key string) {
+	h.fields = deleteFields(h.fields, key)
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	return v, ok
+func deleteFields(fields []field, key string) []field {
+	kept := fields[:0]
+	for _, f := range fields {
+		if !strings.EqualFold(f.name, key) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	if ok {
-		value = strings.Join([]string{
-			v,
-			value,
-		}, ", ")
+// Clone returns a copy that can be modified without affecting h.
+func (h *Headers) Clone() *Headers {
+	if h == nil {
+		return NewHeaders()
 	}
-	h[key] = value
+	return &Headers{fields: append([]field(nil), h.fields...)}
 }
 
-func (h Headers) Override(key, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
 }
 
-func (h Headers) Remove(key string) {
-	key = strings.ToLower(key)
-	delete(h, key)
+// All iterates over every field line in order with its original name.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if !yield(f.name, f.value) {
+				return
+			}
+		}
+	}
 }
 
 var specialChars string = "!#$%&'*+-.^_`|~"
 
 func checkValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
 	for _, char := range key {
 		if strings.ContainsRune(specialChars, char) ||
 			(char >= 'A' && char <= 'Z') ||
@@ -14,7 +14,7 @@ func TestHeader(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -35,13 +35,14 @@ func TestHeader(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"user-agent": "curl/7.81.0"}
+	headers = NewHeaders()
+	headers.Add("User-Agent", "curl/7.81.0")
 	data = []byte("Host: localhost:42069\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(headers, "user-agent"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -68,17 +69,77 @@ func TestHeader(t *testing.T) {
 	data = []byte("HOsT: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Multiple values in single key
-	headers = map[string]string{"host": "localhost:69420"}
+	headers = NewHeaders()
+	headers.Add("Host", "localhost:69420")
 	data = []byte("Host: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:69420, localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:69420, localhost:42069", get(headers, "host"))
+	assert.Equal(t, []string{"localhost:69420", "localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 }
+
+func TestHeaderModel(t *testing.T) {
+	// Test: Order and original casing are kept
+	headers := NewHeaders()
+	data := []byte("Content-Type: text/html\r\nSet-Cookie: a=1\r\nX-Request-ID: 42\r\nset-cookie: b=2\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	var lines []string
+	for key, value := range headers.All() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{
+		"Content-Type: text/html",
+		"Set-Cookie: a=1",
+		"X-Request-ID: 42",
+		"set-cookie: b=2",
+	}, lines)
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("Set-Cookie"))
+	assert.Equal(t, 4, headers.Len())
+
+	// Test: Set replaces every value in place
+	clone := headers.Clone()
+	headers.Set("SET-COOKIE", "c=3")
+	assert.Equal(t, []string{"c=3"}, headers.Values("set-cookie"))
+	assert.Equal(t, 3, headers.Len())
+	var keys []string
+	for key := range headers.All() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"Content-Type", "SET-COOKIE", "X-Request-ID"}, keys)
+
+	// Test: Clone is independent
+	assert.Equal(t, []string{"a=1", "b=2"}, clone.Values("Set-Cookie"))
+
+	// Test: Add and Del
+	headers.Add("Vary", "Accept")
+	headers.Add("Vary", "Accept-Encoding")
+	assert.Equal(t, "Accept, Accept-Encoding", get(headers, "vary"))
+	headers.Del("vary")
+	_, ok := headers.Get("Vary")
+	assert.False(t, ok)
+
+	// Test: Cookie fields are joined with semicolons
+	headers.Add("Cookie", "a=1")
+	headers.Add("Cookie", "b=2")
+	assert.Equal(t, "a=1; b=2", get(headers, "cookie"))
+}
+
+func get(h *Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
@@ -0,0 +1,194 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/AbdKaan/httpfromtcp/internal/chunked"
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+)
+
+// Body parses the framing of a message body and holds the decoded bytes
+// until they are read.
+type Body struct {
+	state bodyState
+	// pending holds decoded body bytes that were parsed but not yet read
+	pending []byte
+	// remaining is the number of bytes left in a Content-Length body
+	remaining int
+	// chunkRemaining is the number of bytes left in the current chunk
+	chunkRemaining int
+	read           int64
+	maxBytes       int64
+	// trailers and fields take the trailer section of a chunked body
+	trailers *headers.Headers
+	fields   *Fields
+}
+
+type bodyState int
+
+const (
+	bodyStateDone bodyState = iota
+	bodyStateFixed
+	bodyStateChunkSize
+	bodyStateChunkData
+	bodyStateChunkDataEnd
+	bodyStateTrailers
+	bodyStateUntilClose
+)
+
+// NewFixedBody returns a body of length bytes, as given by Content-Length.
+func NewFixedBody(length int, maxBytes int64) *Body {
+	b := &Body{state: bodyStateFixed, remaining: length, maxBytes: maxBytes}
+	if length == 0 {
+		b.state = bodyStateDone
+	}
+	return b
+}
+
+// NewChunkedBody returns a chunked body whose trailer fields are parsed into
+// trailers with fields. maxBytes limits the body after removing its
+// framing, 0 means no limit.
+func NewChunkedBody(trailers *headers.Headers, fields *Fields, maxBytes int64) *Body {
+	return &Body{
+		state:    bodyStateChunkSize,
+		maxBytes: maxBytes,
+		trailers: trailers,
+		fields:   fields,
+	}
+}
+
+// NewUntilCloseBody returns a body that ends when the connection closes.
+func NewUntilCloseBody(maxBytes int64) *Body {
+	return &Body{state: bodyStateUntilClose, maxBytes: maxBytes}
+}
+
+// Done reports whether the whole body has been parsed. Decoded bytes may
+// still be pending.
+func (b *Body) Done() bool {
+	return b.state == bodyStateDone
+}
+
+// Pending returns the number of decoded bytes that were parsed but not yet
+// read.
+func (b *Body) Pending() int {
+	return len(b.pending)
+}
+
+// EOF ends a body delimited by the connection closing and reports whether
+// the body was one.
+func (b *Body) EOF() bool {
+	if b.state != bodyStateUntilClose {
+		return false
+	}
+	b.state = bodyStateDone
+	return true
+}
+
+// Parse parses as much of the body at the start of data as it can and
+// returns the number of bytes it used. Anything past the end of the body
+// belongs to the next message on the connection.
+func (b *Body) Parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+	for b.state != bodyStateDone {
+		state := b.state
+		bytesParsed, err := b.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return 0, err
+		}
+		totalBytesParsed += bytesParsed
+		if bytesParsed == 0 && b.state == state {
+			break
+		}
+	}
+	return totalBytesParsed, nil
+}
+
+func (b *Body) parseSingle(data []byte) (int, error) {
+	switch b.state {
+	case bodyStateFixed, bodyStateChunkData, bodyStateUntilClose:
+		data = data[:min(len(data), b.direct())]
+		if err := b.advance(len(data)); err != nil {
+			return 0, err
+		}
+		b.pending = append(b.pending, data...)
+		return len(data), nil
+	case bodyStateChunkSize:
+		err := CheckLineLength(data, maxChunkSizeLineBytes, errChunkSizeLineTooLong)
+		if err != nil {
+			return 0, err
+		}
+		chunkSize, n, err := chunked.ParseSize(data)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, nil
+		}
+		if chunkSize == 0 {
+			b.state = bodyStateTrailers
+		} else {
+			b.chunkRemaining = chunkSize
+			b.state = bodyStateChunkData
+		}
+		return n, nil
+	case bodyStateChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("missing CRLF after chunk data")
+		}
+		b.state = bodyStateChunkSize
+		return len(crlf), nil
+	case bodyStateTrailers:
+		bytesParsed, done, err := b.fields.Parse(b.trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			b.state = bodyStateDone
+		}
+		return bytesParsed, nil
+	default:
+		return 0, fmt.Errorf("unknown body state")
+	}
+}
+
+// direct returns how many of the next bytes are body data without any
+// framing, which can be read from the connection as they are.
+func (b *Body) direct() int {
+	switch b.state {
+	case bodyStateFixed:
+		return b.remaining
+	case bodyStateChunkData:
+		return b.chunkRemaining
+	case bodyStateUntilClose:
+		return math.MaxInt
+	default:
+		return 0
+	}
+}
+
+// advance records n bytes of body data, at most direct, enforcing the body
+// limit.
+func (b *Body) advance(n int) error {
+	b.read += int64(n)
+	if b.maxBytes > 0 && b.read > b.maxBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, b.maxBytes)
+	}
+	switch b.state {
+	case bodyStateFixed:
+		b.remaining -= n
+		if b.remaining == 0 {
+			b.state = bodyStateDone
+		}
+	case bodyStateChunkData:
+		b.chunkRemaining -= n
+		if b.chunkRemaining == 0 {
+			b.state = bodyStateChunkDataEnd
+		}
+	}
+	return nil
+}
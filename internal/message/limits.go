@@ -0,0 +1,65 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+)
+
+// maxChunkSizeLineBytes bounds a chunk-size line including its extensions
+const maxChunkSizeLineBytes = 4 << 10
+
+var (
+	ErrHeaderFieldsTooLarge = errors.New("header fields too large")
+	ErrBodyTooLarge         = errors.New("body too large")
+	errChunkSizeLineTooLong = errors.New("chunk size line too long")
+)
+
+// CheckLineLength returns err if the line at the start of data is, or is
+// bound to be, longer than limit. A limit of 0 or less means no limit.
+func CheckLineLength(data []byte, limit int, err error) error {
+	if limit <= 0 {
+		return nil
+	}
+	idx := bytes.Index(data, []byte(crlf))
+	if idx > limit || (idx == -1 && len(data) > limit+1) {
+		return err
+	}
+	return nil
+}
+
+// Fields parses the header and trailer field lines of a message, which
+// count towards the same limits. A zero limit means no limit.
+type Fields struct {
+	// MaxFieldBytes limits a single field line
+	MaxFieldBytes int
+	// MaxBytes limits all field lines together
+	MaxBytes int
+	// MaxCount limits the number of field lines
+	MaxCount int
+	count    int
+	bytes    int
+}
+
+// Parse parses the field line at the start of data into h, as
+// headers.Headers.Parse does, enforcing the limits.
+func (f *Fields) Parse(h *headers.Headers, data []byte) (int, bool, error) {
+	if err := CheckLineLength(data, f.MaxFieldBytes, ErrHeaderFieldsTooLarge); err != nil {
+		return 0, false, err
+	}
+	n, done, err := h.Parse(data)
+	if err != nil || done || n == 0 {
+		return n, done, err
+	}
+	f.count++
+	f.bytes += n
+	if f.MaxCount > 0 && f.count > f.MaxCount {
+		return 0, false, fmt.Errorf("%w: more than %d fields", ErrHeaderFieldsTooLarge, f.MaxCount)
+	}
+	if f.MaxBytes > 0 && f.bytes > f.MaxBytes {
+		return 0, false, fmt.Errorf("%w: more than %d bytes", ErrHeaderFieldsTooLarge, f.MaxBytes)
+	}
+	return n, false, nil
+}
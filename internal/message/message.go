@@ -0,0 +1,200 @@
+// Package message holds the framing of HTTP/1.1 messages shared by the
+// request and response parsers: reading successive messages from a
+// connection, the body state machine and the header field limits.
+package message
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+)
+
+const crlf = "\r\n"
+
+const bufferSize = 8
+
+// Message is a request or response being parsed by Reader.ParseUntil.
+type Message interface {
+	// Parse consumes what it can of data and returns the number of bytes it
+	// used, 0 if it needs more data
+	Parse(data []byte) (int, error)
+	// Started reports whether the start line has been parsed
+	Started() bool
+	// EOF is called when the connection ends before the message does. It
+	// reports whether that completes the message, as it does a body
+	// delimited by the connection closing.
+	EOF() bool
+}
+
+// Reader reads successive messages from a single connection. Bytes read
+// past the end of one message are kept for the next one, so pipelined
+// messages on a persistent connection are not lost.
+type Reader struct {
+	reader      io.Reader
+	buffer      []byte
+	readToIndex int
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buffer: make([]byte, bufferSize, bufferSize),
+	}
+}
+
+// Buffered returns the number of bytes read from the connection but not
+// parsed yet.
+func (r *Reader) Buffered() int {
+	return r.readToIndex
+}
+
+// Fill blocks until at least one byte is buffered. Errors from the
+// underlying reader are returned as is.
+func (r *Reader) Fill() error {
+	for r.readToIndex == 0 {
+		numBytesRead, err := r.reader.Read(r.buffer)
+		r.readToIndex += numBytesRead
+		if numBytesRead == 0 && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseUntil feeds buffered and newly read data to m until done reports
+// true. If the connection fails or is closed before any byte of m arrives,
+// the error from the underlying reader is returned as is (io.EOF for a
+// clean close).
+func (r *Reader) ParseUntil(m Message, done func() bool) error {
+	for {
+		// Parse what is already buffered first, the previous message may have
+		// left the start of this one behind
+		numBytesParsed, err := m.Parse(r.buffer[:r.readToIndex])
+		if err != nil {
+			return fmt.Errorf("error parsing data: %w", err)
+		}
+
+		// Remove the data that was successfully parsed from the buffer
+		copy(r.buffer, r.buffer[numBytesParsed:r.readToIndex])
+		r.readToIndex -= numBytesParsed
+
+		if done() {
+			return nil
+		}
+
+		// If the buffer is full, grow it
+		if r.readToIndex >= len(r.buffer) {
+			newBuffer := make([]byte, len(r.buffer)*2)
+			copy(newBuffer, r.buffer)
+			r.buffer = newBuffer
+		}
+
+		numBytesRead, err := r.reader.Read(r.buffer[r.readToIndex:])
+		r.readToIndex += numBytesRead
+		if numBytesRead > 0 {
+			continue
+		}
+		if err != nil {
+			if err := r.readFailed(m, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readFailed handles the connection failing with err before m is complete.
+// It returns nil if that completes m.
+func (r *Reader) readFailed(m Message, err error) error {
+	if errors.Is(err, io.EOF) && m.EOF() {
+		return nil
+	}
+	if !m.Started() && r.readToIndex == 0 {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("incomplete message: %w", io.ErrUnexpectedEOF)
+	}
+	return fmt.Errorf("error reading from buffer: %w", err)
+}
+
+// ReadBody reads the decoded bytes of body, which belongs to m, into p. More
+// of the connection is parsed when no bytes are pending. It returns io.EOF
+// at the end of the body, a nil body is empty.
+func (r *Reader) ReadBody(m Message, body *Body, p []byte) (int, error) {
+	if body == nil {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(body.pending) == 0 && !body.Done() {
+		// Body data that is not buffered yet is read straight into p, so a
+		// large body takes reads as large as p and is not copied on the way
+		if n := body.direct(); n > 0 && r.readToIndex == 0 {
+			return r.readDirect(m, body, p[:min(len(p), n)])
+		}
+		err := r.ParseUntil(m, func() bool {
+			return len(body.pending) > 0 || body.Done() ||
+				(r.readToIndex == 0 && body.direct() > 0)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(body.pending) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, body.pending)
+	body.pending = body.pending[n:]
+	return n, nil
+}
+
+// readDirect reads body data from the connection into p, which is no longer
+// than the data left before the next framing.
+func (r *Reader) readDirect(m Message, body *Body, p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n == 0 {
+		if err == nil {
+			return 0, nil
+		}
+		if err := r.readFailed(m, err); err != nil {
+			return 0, err
+		}
+		// The body ended with the connection
+		return 0, io.EOF
+	}
+	if err := body.advance(n); err != nil {
+		return 0, fmt.Errorf("error parsing data: %w", err)
+	}
+	// Let the message see the end of the body
+	if _, err := m.Parse(nil); err != nil {
+		return 0, fmt.Errorf("error parsing data: %w", err)
+	}
+	return n, nil
+}
+
+// HasToken reports whether the comma-separated values of the fields named
+// name in h contain token, ignoring case.
+func HasToken(h *headers.Headers, name, token string) bool {
+	value, _ := h.Get(name)
+	for _, option := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(option), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepAlive reports whether a message with the given HTTP version and
+// headers lets the connection be reused. HTTP/1.1 connections are
+// persistent unless "Connection: close" is sent, HTTP/1.0 ones only if
+// "Connection: keep-alive" is.
+func KeepAlive(httpVersion string, h *headers.Headers) bool {
+	if HasToken(h, "connection", "close") {
+		return false
+	}
+	return httpVersion != "1.0" || HasToken(h, "connection", "keep-alive")
+}
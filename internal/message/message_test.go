@@ -0,0 +1,126 @@
+package message
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlive(t *testing.T) {
+	h := headers.NewHeaders()
+
+	// Test: HTTP/1.1 is persistent by default, HTTP/1.0 is not
+	assert.True(t, KeepAlive("1.1", h))
+	assert.False(t, KeepAlive("1.0", h))
+
+	// Test: Tokens are found in any field line, ignoring case
+	h.Add("Connection", "Upgrade")
+	h.Add("Connection", "foo, Keep-Alive")
+	assert.True(t, HasToken(h, "connection", "keep-alive"))
+	assert.True(t, KeepAlive("1.0", h))
+
+	// Test: close wins
+	h.Add("Connection", "CLOSE")
+	assert.False(t, KeepAlive("1.1", h))
+	assert.False(t, KeepAlive("1.0", h))
+}
+
+// body is a Message that is nothing but a body.
+type body struct {
+	*Body
+}
+
+func (b body) Started() bool {
+	return true
+}
+
+// countingReader counts the reads made from it.
+type countingReader struct {
+	reader io.Reader
+	reads  int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.reader.Read(p)
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestBody(t *testing.T) {
+	read := func(b *Body, data string) (string, error) {
+		reader := NewReader(strings.NewReader(data))
+		var out []byte
+		p := make([]byte, 3)
+		for {
+			n, err := reader.ReadBody(body{b}, b, p)
+			out = append(out, p[:n]...)
+			if err == io.EOF {
+				return string(out), nil
+			}
+			if err != nil {
+				return string(out), err
+			}
+		}
+	}
+
+	// Test: Fixed length body leaves the rest for the next message
+	b := NewFixedBody(5, 0)
+	out, err := read(b, "helloGET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", out)
+
+	// Test: Chunked body with trailers
+	trailers := headers.NewHeaders()
+	b = NewChunkedBody(trailers, &Fields{}, 0)
+	out, err = read(b, "5\r\nhello\r\n6;ext=1\r\n world\r\n0\r\nX-Sum: 11\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", out)
+	sum, _ := trailers.Get("X-Sum")
+	assert.Equal(t, "11", sum)
+
+	// Test: Body until the connection closes
+	b = NewUntilCloseBody(0)
+	out, err = read(b, "all of it")
+	require.NoError(t, err)
+	assert.Equal(t, "all of it", out)
+
+	// Test: Body and trailer limits
+	_, err = read(NewChunkedBody(headers.NewHeaders(), &Fields{}, 8), "5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = read(NewChunkedBody(headers.NewHeaders(), &Fields{MaxCount: 1}, 0), "0\r\nA: 1\r\nB: 2\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Large bodies are read in reads as large as the caller's buffer
+	data := strings.Repeat("x", 100<<10)
+	for _, b := range []*Body{
+		NewFixedBody(len(data), 0),
+		NewChunkedBody(headers.NewHeaders(), &Fields{}, 0),
+	} {
+		wire := data
+		if b.state == bodyStateChunkSize {
+			wire = fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(data), data)
+		}
+		conn := &countingReader{reader: strings.NewReader(wire)}
+		reader := NewReader(conn)
+		n, err := io.CopyBuffer(io.Discard, readerFunc(func(p []byte) (int, error) {
+			return reader.ReadBody(body{b}, b, p)
+		}), make([]byte, 32<<10))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), n)
+		assert.Less(t, conn.reads, 20)
+	}
+
+	// Test: Connection closing early
+	_, err = read(NewFixedBody(10, 0), "short")
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
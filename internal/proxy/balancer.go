@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/client"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+)
+
+// Upstream is one backend server along with the state the proxy keeps to
+// decide whether to send it traffic.
+type Upstream struct {
+	URL *url.URL
+
+	active atomic.Int64
+
+	mu sync.Mutex
+	// unhealthy is set while the active health check fails
+	unhealthy    bool
+	ejectedUntil time.Time
+}
+
+func NewUpstream(rawURL string) (*Upstream, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %s: %v", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported upstream scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("upstream %s has no host", rawURL)
+	}
+	return &Upstream{URL: u}, nil
+}
+
+// Available reports whether the upstream passed its last health check and
+// is not ejected after a connection error.
+func (u *Upstream) Available() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.unhealthy && !time.Now().Before(u.ejectedUntil)
+}
+
+// ActiveRequests is the number of requests currently forwarded to the
+// upstream.
+func (u *Upstream) ActiveRequests() int64 {
+	return u.active.Load()
+}
+
+func (u *Upstream) eject(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ejectedUntil = time.Now().Add(d)
+}
+
+func (u *Upstream) setHealthy(healthy bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if healthy && u.unhealthy {
+		log.Printf("proxy: upstream %s is healthy again", u.URL)
+	} else if !healthy && !u.unhealthy {
+		log.Printf("proxy: upstream %s failed its health check", u.URL)
+	}
+	u.unhealthy = !healthy
+	// A passing check also ends an ejection early
+	if healthy {
+		u.ejectedUntil = time.Time{}
+	}
+}
+
+// Strategy picks the upstream for a request from the available ones, which
+// is never an empty list.
+type Strategy func(upstreams []*Upstream, req *request.Request) *Upstream
+
+// RoundRobin sends requests to each upstream in turn.
+func RoundRobin() Strategy {
+	var next atomic.Uint64
+	return func(upstreams []*Upstream, _ *request.Request) *Upstream {
+		n := next.Add(1) - 1
+		return upstreams[n%uint64(len(upstreams))]
+	}
+}
+
+// LeastConnections sends requests to the upstream with the fewest requests
+// in flight, taking turns between upstreams that are tied.
+func LeastConnections() Strategy {
+	var next atomic.Uint64
+	return func(upstreams []*Upstream, _ *request.Request) *Upstream {
+		start := int((next.Add(1) - 1) % uint64(len(upstreams)))
+		var best *Upstream
+		for i := range upstreams {
+			u := upstreams[(start+i)%len(upstreams)]
+			if best == nil || u.ActiveRequests() < best.ActiveRequests() {
+				best = u
+			}
+		}
+		return best
+	}
+}
+
+// HashHeader sends requests with the same value for the header to the same
+// upstream. It uses rendezvous hashing, so an upstream going away only moves
+// the requests that were sent to it. Requests without the header are spread
+// round-robin.
+func HashHeader(name string) Strategy {
+	fallback := RoundRobin()
+	return func(upstreams []*Upstream, req *request.Request) *Upstream {
+		key, ok := req.Headers.Get(name)
+		if !ok {
+			return fallback(upstreams, req)
+		}
+		var best *Upstream
+		var bestScore uint64
+		for _, u := range upstreams {
+			h := fnv.New64a()
+			h.Write([]byte(u.URL.String()))
+			h.Write([]byte{0})
+			h.Write([]byte(key))
+			if score := h.Sum64(); best == nil || score > bestScore {
+				best, bestScore = u, score
+			}
+		}
+		return best
+	}
+}
+
+// HealthCheck describes the requests used to check upstreams. An upstream
+// that does not answer Path with a 2xx status within Timeout gets no
+// traffic until it does again. Interval and Timeout default to 10 and 5
+// seconds.
+type HealthCheck struct {
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// StartHealthChecks checks every upstream right away and then once per
+// Interval until stop is called.
+func (p *ReverseProxy) StartHealthChecks(check HealthCheck) (stop func()) {
+	if check.Interval <= 0 {
+		check.Interval = defaultHealthInterval
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = defaultHealthTimeout
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(check.Interval)
+		defer ticker.Stop()
+		for {
+			p.checkHealth(check)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// checkHealth checks all upstreams concurrently and waits for the results.
+func (p *ReverseProxy) checkHealth(check HealthCheck) {
+	c := client.New()
+	c.DialTimeout = check.Timeout
+	c.ResponseHeaderTimeout = check.Timeout
+	if p.Client != nil {
+		c.TLSConfig = p.Client.TLSConfig
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range p.Upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.setHealthy(probe(c, u, check.Path))
+		}()
+	}
+	wg.Wait()
+}
+
+func probe(c *client.Client, u *Upstream, path string) bool {
+	target := *u.URL
+	target.Path = joinPath(target.Path, path)
+	target.RawPath = ""
+	target.RawQuery = ""
+	req, err := client.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Headers.Set("Connection", "close")
+	resp, err := c.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
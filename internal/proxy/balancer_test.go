@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedUpstream answers every request with its name, and the health check
+// path with healthStatus.
+func namedUpstream(t *testing.T, name string, healthStatus response.StatusCode) string {
+	return newUpstream(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/health" {
+			w.WriteStatusLine(healthStatus)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+			return
+		}
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		w.WriteHeaders(response.GetDefaultHeaders(len(name)))
+		w.WriteBody([]byte(name))
+	})
+}
+
+// deadUpstream returns the URL of a port nothing listens on.
+func deadUpstream(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return "http://" + addr
+}
+
+func servedBy(t *testing.T, p *ReverseProxy, method string, h *headers.Headers) string {
+	resp := serve(t, p, newRequest(t, method, "/", "", h))
+	return string(resp.Body)
+}
+
+func TestStrategies(t *testing.T) {
+	a := namedUpstream(t, "a", response.StatusCodeSuccess)
+	b := namedUpstream(t, "b", response.StatusCodeSuccess)
+	c := namedUpstream(t, "c", response.StatusCodeSuccess)
+
+	// Test: Round-robin takes turns
+	p, err := New(a, b, c)
+	require.NoError(t, err)
+	var got string
+	for range 6 {
+		got += servedBy(t, p, "GET", nil)
+	}
+	assert.Equal(t, "abcabc", got)
+
+	// Test: Consistent hash keeps a key on one upstream
+	p.Strategy = HashHeader("X-User")
+	served := map[string]string{}
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		h := headers.NewHeaders()
+		h.Set("X-User", user)
+		served[user] = servedBy(t, p, "GET", h)
+		for range 3 {
+			h = headers.NewHeaders()
+			h.Set("X-User", user)
+			assert.Equal(t, served[user], servedBy(t, p, "GET", h))
+		}
+	}
+
+	// Test: Removing an upstream only moves the keys it had
+	removed := p.Upstreams[0]
+	removed.eject(time.Minute)
+	for user, name := range served {
+		h := headers.NewHeaders()
+		h.Set("X-User", user)
+		now := servedBy(t, p, "GET", h)
+		if name != "a" {
+			assert.Equal(t, name, now)
+		} else {
+			assert.NotEqual(t, "a", now)
+		}
+	}
+	removed.setHealthy(true)
+
+	// Test: Least connections prefers the least busy upstream
+	p.Upstreams[0].active.Store(3)
+	p.Upstreams[1].active.Store(1)
+	p.Upstreams[2].active.Store(2)
+	pick := LeastConnections()
+	assert.Equal(t, p.Upstreams[1], pick(p.Upstreams, nil))
+	p.Upstreams[1].active.Store(2)
+	first := pick(p.Upstreams, nil)
+	second := pick(p.Upstreams, nil)
+	assert.NotEqual(t, first, second)
+	assert.NotEqual(t, p.Upstreams[0], first)
+	assert.NotEqual(t, p.Upstreams[0], second)
+}
+
+func TestFailover(t *testing.T) {
+	dead := deadUpstream(t)
+	live := namedUpstream(t, "b", response.StatusCodeSuccess)
+
+	// Test: Idempotent request is retried on another upstream
+	p, err := New(dead, live)
+	require.NoError(t, err)
+	assert.Equal(t, "b", servedBy(t, p, "GET", nil))
+
+	// Test: Upstream that refused a connection is ejected
+	assert.False(t, p.Upstreams[0].Available())
+	assert.True(t, p.Upstreams[1].Available())
+	assert.Equal(t, "b", servedBy(t, p, "GET", nil))
+
+	// Test: Request with a body is not retried
+	p, err = New(dead, live)
+	require.NoError(t, err)
+	resp := serve(t, p, newRequest(t, "PUT", "/", "payload", nil))
+	assert.Equal(t, response.StatusCodeBadGateway, resp.StatusCode)
+
+	// Test: Non-idempotent request is not retried
+	p, err = New(dead, live)
+	require.NoError(t, err)
+	resp = serve(t, p, newRequest(t, "POST", "/", "", nil))
+	assert.Equal(t, response.StatusCodeBadGateway, resp.StatusCode)
+
+	// Test: No upstream left is a 503
+	p.Upstreams[1].eject(time.Minute)
+	resp = serve(t, p, newRequest(t, "GET", "/", "", nil))
+	assert.Equal(t, response.StatusCodeServiceUnavailable, resp.StatusCode)
+
+	// Test: Malformed client body is a 400 and does not eject the upstream
+	healthy, err := New(namedUpstream(t, "a", response.StatusCodeSuccess))
+	require.NoError(t, err)
+	raw := "POST / HTTP/1.1\r\nHost: proxy.example\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"
+	req, err := request.NewReader(strings.NewReader(raw)).ReadRequest()
+	require.NoError(t, err)
+	resp = serve(t, healthy, req)
+	assert.Equal(t, response.StatusCodeBadRequest, resp.StatusCode)
+	assert.True(t, healthy.Upstreams[0].Available())
+	assert.Equal(t, "a", servedBy(t, healthy, "GET", nil))
+}
+
+func TestHealthChecks(t *testing.T) {
+	a := namedUpstream(t, "a", response.StatusCodeSuccess)
+	b := namedUpstream(t, "b", response.StatusCodeInternalServerError)
+	p, err := New(a, b, deadUpstream(t))
+	require.NoError(t, err)
+
+	// Test: Failing and unreachable upstreams are taken out of rotation
+	check := HealthCheck{Path: "/health", Interval: time.Hour, Timeout: time.Second}
+	p.checkHealth(check)
+	assert.True(t, p.Upstreams[0].Available())
+	assert.False(t, p.Upstreams[1].Available())
+	assert.False(t, p.Upstreams[2].Available())
+	for range 3 {
+		assert.Equal(t, "a", servedBy(t, p, "GET", nil))
+	}
+
+	// Test: Ejected upstream returns after a passing check
+	p.Upstreams[0].eject(time.Minute)
+	assert.False(t, p.Upstreams[0].Available())
+	stop := p.StartHealthChecks(check)
+	defer stop()
+	require.Eventually(t, p.Upstreams[0].Available, time.Second, 10*time.Millisecond)
+
+	// Test: Zero Interval and Timeout fall back to the defaults
+	p.Upstreams[0].eject(time.Minute)
+	stopDefaults := p.StartHealthChecks(HealthCheck{Path: "/health"})
+	defer stopDefaults()
+	require.Eventually(t, p.Upstreams[0].Available, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,319 @@
+// Package proxy forwards requests to an upstream server and streams the
+// response back to the client.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/client"
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+// hopByHopHeaders only apply to a single connection and are not forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+const (
+	defaultMaxRetries     = 2
+	defaultEjectFor       = 10 * time.Second
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	// defaultResponseHeaderTimeout keeps a stalled upstream from holding
+	// the client's request forever
+	defaultResponseHeaderTimeout = 30 * time.Second
+)
+
+// idempotentMethods can be sent again after a connection error
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// ReverseProxy is a handler that forwards requests to a set of upstreams.
+type ReverseProxy struct {
+	// Upstreams are the servers requests are spread over. The request path
+	// is appended to the upstream's path.
+	Upstreams []*Upstream
+	// Strategy picks the upstream for each request
+	Strategy Strategy
+	// StripPrefix is removed from the request path before it is forwarded
+	StripPrefix string
+	// PreserveHost forwards the client's Host header instead of the
+	// upstream host
+	PreserveHost bool
+	// MaxRetries is how many other upstreams an idempotent request without
+	// a body is sent to when forwarding fails
+	MaxRetries int
+	// EjectFor is how long an upstream gets no traffic after forwarding to
+	// it failed
+	EjectFor time.Duration
+	Client   *client.Client
+}
+
+// New creates a proxy that spreads requests round-robin over the upstream
+// URLs.
+func New(upstreams ...string) (*ReverseProxy, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("no upstreams given")
+	}
+	c := client.New()
+	c.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	p := &ReverseProxy{
+		Strategy:   RoundRobin(),
+		MaxRetries: defaultMaxRetries,
+		EjectFor:   defaultEjectFor,
+		Client:     c,
+	}
+	for _, rawURL := range upstreams {
+		u, err := NewUpstream(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		p.Upstreams = append(p.Upstreams, u)
+	}
+	return p, nil
+}
+
+// Serve is a server.Handler, pass it to server.Serve or register it on a
+// router.
+func (p *ReverseProxy) Serve(w *response.Writer, req *request.Request) {
+	tried := map[*Upstream]bool{}
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		upstream := p.pick(req, tried)
+		if upstream == nil {
+			if lastErr != nil {
+				writeError(w, response.StatusCodeBadGateway)
+			} else {
+				log.Printf("proxy: no upstream available for %s", req.RequestLine.RequestTarget)
+				writeError(w, response.StatusCodeServiceUnavailable)
+			}
+			return
+		}
+		tried[upstream] = true
+
+		outReq, err := p.outgoingRequest(upstream, req)
+		if err != nil {
+			log.Printf("proxy: %v", err)
+			writeError(w, response.StatusCodeBadGateway)
+			return
+		}
+		upstream.active.Add(1)
+		resp, err := p.Client.Do(outReq)
+		if err != nil && errors.Is(err, client.ErrRequestBody) {
+			// The client sent a bad body, which says nothing about the upstream
+			upstream.active.Add(-1)
+			log.Printf("proxy: error reading request body for %s: %v", outReq.URL, err)
+			if errors.Is(err, request.ErrBodyTooLarge) {
+				writeError(w, response.StatusCodeContentTooLarge)
+			} else {
+				writeError(w, response.StatusCodeBadRequest)
+			}
+			return
+		}
+		if err != nil {
+			upstream.active.Add(-1)
+			upstream.eject(p.EjectFor)
+			log.Printf("proxy: error forwarding to %s: %v", outReq.URL, err)
+			lastErr = err
+			// Only requests that did not stream a body can be sent again
+			if attempt < p.MaxRetries && idempotentMethods[outReq.Method] && outReq.ContentLength == 0 {
+				continue
+			}
+			writeError(w, response.StatusCodeBadGateway)
+			return
+		}
+
+		noBody := req.RequestLine.Method == "HEAD"
+		err = copyResponse(w, resp, noBody)
+		resp.Body.Close()
+		upstream.active.Add(-1)
+		if err != nil {
+			log.Printf("proxy: error copying response from %s: %v", outReq.URL, err)
+		}
+		return
+	}
+}
+
+// pick returns an available upstream that was not tried yet, or nil if
+// there is none.
+func (p *ReverseProxy) pick(req *request.Request, tried map[*Upstream]bool) *Upstream {
+	var candidates []*Upstream
+	for _, u := range p.Upstreams {
+		if !tried[u] && u.Available() {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if p.Strategy == nil {
+		return candidates[0]
+	}
+	return p.Strategy(candidates, req)
+}
+
+// outgoingRequest builds the request sent to the upstream, streaming the
+// client's body.
+func (p *ReverseProxy) outgoingRequest(upstream *Upstream, req *request.Request) (*client.Request, error) {
+	rawPath := strings.TrimPrefix(req.Target.RawPath, p.StripPrefix)
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *upstream.URL
+	u.Path = joinPath(u.Path, path)
+	// Keep the client's encoding, such as an encoded "/" in a segment
+	u.RawPath = joinPath(u.EscapedPath(), rawPath)
+	u.RawQuery = req.Target.RawQuery
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	outReq.Headers = req.Headers.Clone()
+	removeHopByHop(outReq.Headers)
+	if !p.PreserveHost {
+		outReq.Headers.Del("Host")
+	}
+	addForwarded(outReq.Headers, req)
+
+	outReq.Body = req.BodyReader()
+	outReq.ContentLength = req.ContentLength()
+	return outReq, nil
+}
+
+// joinPath appends path to the upstream base path.
+func joinPath(base, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// removeHopByHop drops the hop-by-hop headers, including any named in the
+// Connection header.
+func removeHopByHop(h *headers.Headers) {
+	for _, connection := range h.Values("Connection") {
+		for _, name := range strings.Split(connection, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// addForwarded records the client address, host and protocol in both the
+// X-Forwarded-* headers and the standard Forwarded header.
+func addForwarded(h *headers.Headers, req *request.Request) {
+	clientIP := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		clientIP = host
+	}
+	host, _ := req.Headers.Get("host")
+	proto := "http"
+	if req.TLS {
+		proto = "https"
+	}
+
+	if clientIP != "" {
+		if prior, ok := h.Get("X-Forwarded-For"); ok {
+			h.Set("X-Forwarded-For", prior+", "+clientIP)
+		} else {
+			h.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if host != "" {
+		h.Set("X-Forwarded-Host", host)
+	}
+	h.Set("X-Forwarded-Proto", proto)
+
+	// forwarded-element = [ forwarded-pair ] *( ";" [ forwarded-pair ] )
+	// IPv6 addresses and values with a colon have to be quoted
+	var pairs []string
+	if clientIP != "" {
+		if strings.Contains(clientIP, ":") {
+			pairs = append(pairs, fmt.Sprintf("for=\"[%s]\"", clientIP))
+		} else {
+			pairs = append(pairs, "for="+clientIP)
+		}
+	}
+	if host != "" {
+		pairs = append(pairs, fmt.Sprintf("host=%q", host))
+	}
+	pairs = append(pairs, "proto="+proto)
+	h.Add("Forwarded", strings.Join(pairs, ";"))
+}
+
+// copyResponse writes the upstream status, headers and body to the client
+// as they arrive. noBody is set when the response must not have a body.
+func copyResponse(w *response.Writer, resp *client.Response, noBody bool) error {
+	if err := w.WriteStatusLineReason(resp.StatusCode, resp.ReasonPhrase); err != nil {
+		return err
+	}
+
+	h := resp.Headers.Clone()
+	announcedTrailers := h.Values("Trailer")
+	removeHopByHop(h)
+
+	noBody = noBody || resp.StatusCode < 200 ||
+		resp.StatusCode == response.StatusCodeNoContent ||
+		resp.StatusCode == response.StatusCodeNotModified
+	_, hasLength := h.Get("content-length")
+	if hasLength || noBody {
+		if err := w.WriteHeaders(h); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	// Without a length the body is passed on chunked, along with any trailers
+	h.Set("Transfer-Encoding", "chunked")
+	for _, trailer := range announcedTrailers {
+		h.Add("Trailer", trailer)
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return w.WriteTrailers(resp.Trailers)
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode) {
+	w.WriteStatusLine(statusCode)
+	body := []byte(response.StatusText(statusCode) + "\n")
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
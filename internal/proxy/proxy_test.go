@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/AbdKaan/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUpstream starts a backend server with handler and returns its URL.
+func newUpstream(t *testing.T, handler server.Handler) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := server.Serve(handler, listener)
+	t.Cleanup(func() { s.Close() })
+	return "http://" + s.Addr().String()
+}
+
+func serve(t *testing.T, p *ReverseProxy, req *request.Request) *response.Response {
+	buf := &bytes.Buffer{}
+	p.Serve(response.NewWriter(buf), req)
+	resp, err := response.ResponseFromReader(buf)
+	require.NoError(t, err)
+	return resp
+}
+
+func newRequest(t *testing.T, method, target, body string, h *headers.Headers) *request.Request {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	h.Set("Host", "proxy.example")
+	if body != "" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	raw := method + " " + target + " HTTP/1.1\r\n"
+	for key, value := range h.All() {
+		raw += key + ": " + value + "\r\n"
+	}
+	raw += "\r\n" + body
+	req, err := request.NewReader(strings.NewReader(raw)).ReadRequest()
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+	return req
+}
+
+func TestReverseProxy(t *testing.T) {
+	var seen *request.Request
+	upstream := newUpstream(t, func(w *response.Writer, req *request.Request) {
+		seen = req
+		body, err := req.ReadBody()
+		assert.NoError(t, err)
+		if req.RequestLine.RequestTarget == "/base/stream" {
+			w.WriteStatusLine(response.StatusCodeSuccess)
+			h := headers.NewHeaders()
+			h.Set("Transfer-Encoding", "chunked")
+			h.Set("Trailer", "X-Checksum")
+			w.WriteHeaders(h)
+			w.WriteChunkedBody([]byte("hello"))
+			w.WriteChunkedBodyDone()
+			trailers := headers.NewHeaders()
+			trailers.Set("X-Checksum", "abc")
+			w.WriteTrailers(trailers)
+			return
+		}
+		w.WriteStatusLineReason(418, "Short And Stout")
+		h := headers.NewHeaders()
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		h.Set("Keep-Alive", "timeout=5")
+		h.Set("X-Upstream", "yes")
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	p, err := New(upstream + "/base")
+	require.NoError(t, err)
+	p.StripPrefix = "/api"
+
+	// Test: Method, path, query, headers and body are forwarded
+	h := headers.NewHeaders()
+	h.Set("Connection", "X-Secret")
+	h.Set("X-Secret", "hop")
+	h.Set("X-Custom", "kept")
+	h.Set("X-Forwarded-For", "198.51.100.1")
+	resp := serve(t, p, newRequest(t, "PUT", "/api/items/1?x=y", "payload", h))
+	require.NotNil(t, seen)
+	assert.Equal(t, "PUT", seen.RequestLine.Method)
+	assert.Equal(t, "/base/items/1?x=y", seen.RequestLine.RequestTarget)
+	assert.Equal(t, "payload", string(seen.Body))
+	assert.Equal(t, []string{"kept"}, seen.Headers.Values("X-Custom"))
+	assert.Empty(t, seen.Headers.Values("X-Secret"))
+	assert.Equal(t, []string{strings.TrimPrefix(upstream, "http://")}, seen.Headers.Values("Host"))
+	assert.Equal(t, []string{"198.51.100.1, 192.0.2.7"}, seen.Headers.Values("X-Forwarded-For"))
+	assert.Equal(t, []string{"proxy.example"}, seen.Headers.Values("X-Forwarded-Host"))
+	assert.Equal(t, []string{`for=192.0.2.7;host="proxy.example";proto=http`}, seen.Headers.Values("Forwarded"))
+	assert.Equal(t, []string{"http"}, seen.Headers.Values("X-Forwarded-Proto"))
+
+	// Test: Upstream status, reason, headers and body are passed back
+	assert.Equal(t, response.StatusCode(418), resp.StatusCode)
+	assert.Equal(t, "Short And Stout", resp.ReasonPhrase)
+	assert.Equal(t, []string{"yes"}, resp.Headers.Values("X-Upstream"))
+	assert.Empty(t, resp.Headers.Values("Keep-Alive"))
+	assert.Equal(t, "payload", string(resp.Body))
+
+	// Test: Chunked upstream body is streamed with its trailers
+	resp = serve(t, p, newRequest(t, "GET", "/api/stream", "", nil))
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Equal(t, "hello", string(resp.Body))
+	assert.Equal(t, []string{"abc"}, resp.Trailers.Values("X-Checksum"))
+
+	// Test: Requests that arrived over TLS are forwarded with proto https
+	req := newRequest(t, "GET", "/api/stream", "", nil)
+	req.TLS = true
+	serve(t, p, req)
+	assert.Equal(t, []string{"https"}, seen.Headers.Values("X-Forwarded-Proto"))
+	assert.Equal(t, []string{`for=192.0.2.7;host="proxy.example";proto=https`}, seen.Headers.Values("Forwarded"))
+
+	// Test: Upstreams have a default time to answer
+	assert.Equal(t, defaultResponseHeaderTimeout, p.Client.ResponseHeaderTimeout)
+
+	// Test: Unreachable upstream is a 502
+	down, err := New("http://127.0.0.1:1")
+	require.NoError(t, err)
+	resp = serve(t, down, newRequest(t, "GET", "/", "", nil))
+	assert.Equal(t, response.StatusCodeBadGateway, resp.StatusCode)
+}
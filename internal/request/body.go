@@ -0,0 +1,72 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// bodyReader streams the body of a request from its connection, decoding
+// the Content-Length or chunked framing as it goes.
+type bodyReader struct {
+	request *Request
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	r := b.request
+	if r.sendContinue != nil {
+		sendContinue := r.sendContinue
+		r.sendContinue = nil
+		if r.state != requestStateDone {
+			if err := sendContinue(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return r.reader.conn.ReadBody(parser{r}, r.body, p)
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue"
+// and is waiting for an interim response before sending the body.
+func (r *Request) ExpectsContinue() bool {
+	expect, ok := r.Headers.Get("expect")
+	return ok && strings.EqualFold(strings.TrimSpace(expect), "100-continue") &&
+		r.state != requestStateDone
+}
+
+// SetContinueFunc sets fn to be called the first time the body is read, so
+// "100 Continue" is only sent once the handler wants the body. A handler
+// that answers without reading the body never calls it.
+func (r *Request) SetContinueFunc(fn func() error) {
+	r.sendContinue = fn
+}
+
+// BodyReader returns a reader over the request body. The body is read from
+// the connection as the reader is consumed, so it can only be read once.
+func (r *Request) BodyReader() io.Reader {
+	if r.reader == nil || r.bodyBuffered {
+		return bytes.NewReader(r.Body)
+	}
+	if len(r.decodings) > 0 {
+		if r.decoder == nil {
+			r.decoder = newDecodingReader(&bodyReader{request: r}, r.decodings, r.limits.MaxDecodedBodyBytes)
+		}
+		return r.decoder
+	}
+	return &bodyReader{request: r}
+}
+
+// ReadBody reads the rest of the body into r.Body and returns it, up to
+// Limits.MaxBufferedBodyBytes.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.bodyBuffered {
+		return r.Body, nil
+	}
+	body, err := readLimited(r.BodyReader(), r.limits.MaxBufferedBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = append(r.Body, body...)
+	r.bodyBuffered = true
+	return r.Body, nil
+}
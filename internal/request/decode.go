@@ -0,0 +1,142 @@
+package request
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnsupportedContentEncoding = errors.New("unsupported Content-Encoding")
+
+// SupportedContentEncodings lists the codings a Reader with
+// DecodeContentEncoding set can decode, for an Accept-Encoding response
+// header
+const SupportedContentEncodings = "gzip, deflate"
+
+// parseContentEncoding returns the codings applied to the body in the order
+// they were applied, leaving out identity.
+func parseContentEncoding(value string) ([]string, error) {
+	var codings []string
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			codings = append(codings, "gzip")
+		case "deflate":
+			codings = append(codings, "deflate")
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, coding)
+		}
+	}
+	return codings, nil
+}
+
+// decodeContentEncoding makes the body reader undo the Content-Encoding.
+// The headers then describe the decoded body, whose length is unknown.
+func (r *Request) decodeContentEncoding() error {
+	value, ok := r.Headers.Get("content-encoding")
+	if !ok {
+		return nil
+	}
+	codings, err := parseContentEncoding(value)
+	if err != nil {
+		return err
+	}
+	r.Headers.Del("Content-Encoding")
+	// An empty body stays empty
+	if len(codings) == 0 || r.contentLength == 0 {
+		return nil
+	}
+	r.decodings = codings
+	r.Headers.Del("Content-Length")
+	r.contentLength = -1
+	return nil
+}
+
+// decodingReader undoes the content codings of the body it reads from. The
+// decompressors are set up on the first Read, as they read the stream
+// header right away.
+type decodingReader struct {
+	source  io.Reader
+	codings []string
+	limit   int64
+	decoded int64
+	reader  io.Reader
+	err     error
+}
+
+func newDecodingReader(source io.Reader, codings []string, limit int64) *decodingReader {
+	return &decodingReader{source: source, codings: codings, limit: limit}
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.reader == nil {
+		if err := d.init(); err != nil {
+			d.err = err
+			return 0, err
+		}
+	}
+	n, err := d.reader.Read(p)
+	d.decoded += int64(n)
+	if d.limit > 0 && d.decoded > d.limit {
+		d.err = fmt.Errorf("%w: more than %d bytes after decoding", ErrBodyTooLarge, d.limit)
+		return 0, d.err
+	}
+	if err != nil && err != io.EOF {
+		d.err = fmt.Errorf("error decoding body: %w", err)
+		return n, d.err
+	}
+	return n, err
+}
+
+func (d *decodingReader) init() error {
+	reader := d.source
+	// The last coding listed was applied last, so it is undone first
+	for i := len(d.codings) - 1; i >= 0; i-- {
+		switch d.codings[i] {
+		case "gzip":
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				return fmt.Errorf("error decoding body: %w", err)
+			}
+			reader = gz
+		case "deflate":
+			var err error
+			reader, err = newDeflateReader(reader)
+			if err != nil {
+				return fmt.Errorf("error decoding body: %w", err)
+			}
+		}
+	}
+	d.reader = reader
+	return nil
+}
+
+// newDeflateReader reads the zlib stream HTTP calls deflate. Some clients
+// send a raw deflate stream instead, which is detected by the missing zlib
+// header.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	// CMF and FLG: compression method 8 and a checksum that is a multiple
+	// of 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
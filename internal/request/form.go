@@ -0,0 +1,217 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+)
+
+var (
+	ErrNotForm      = errors.New("request body is not application/x-www-form-urlencoded")
+	ErrNotMultipart = errors.New("request body is not multipart/form-data")
+)
+
+// DefaultMaxMemory is how much of the files in a multipart form
+// ParseMultipartForm keeps in memory when given a maxMemory of 0
+const DefaultMaxMemory = 32 << 20
+
+// Form parses an application/x-www-form-urlencoded body. The body is read
+// in full, up to Limits.MaxFormBytes. Query parameters are not included, they
+// are returned by Query.
+func (r *Request) Form() (url.Values, error) {
+	if r.form != nil {
+		return r.form, nil
+	}
+	mediaType, _, err := r.mediaType()
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil, ErrNotForm
+	}
+	if !r.bodyBuffered {
+		body, err := readLimited(r.BodyReader(), r.limits.MaxFormBytes)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = append(r.Body, body...)
+		r.bodyBuffered = true
+	}
+	form, err := url.ParseQuery(string(r.Body))
+	if err != nil {
+		return nil, fmt.Errorf("malformed form body: %w", err)
+	}
+	r.form = form
+	return form, nil
+}
+
+// MultipartReader returns a reader over the parts of a multipart/form-data
+// body, for handlers that stream the parts instead of using
+// ParseMultipartForm.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	mediaType, params, err := r.mediaType()
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" || len(boundary) > 70 {
+		return nil, fmt.Errorf("%w: missing or invalid boundary", ErrNotMultipart)
+	}
+	return NewMultipartReader(r.BodyReader(), boundary), nil
+}
+
+// MultipartForm is a parsed multipart/form-data body.
+type MultipartForm struct {
+	Value url.Values
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes a file part of a multipart form. Its content is held
+// in memory or spooled to a temporary file, Open reads it either way.
+type FileHeader struct {
+	Filename string
+	Headers  *headers.Headers
+	Size     int64
+	content  []byte
+	tmpFile  string
+}
+
+// Open returns the content of the file.
+func (fh *FileHeader) Open() (io.ReadCloser, error) {
+	if fh.tmpFile != "" {
+		return os.Open(fh.tmpFile)
+	}
+	return io.NopCloser(bytes.NewReader(fh.content)), nil
+}
+
+// RemoveAll removes the temporary files of the form.
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, files := range f.File {
+		for _, fh := range files {
+			if fh.tmpFile == "" {
+				continue
+			}
+			if err := os.Remove(fh.tmpFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseMultipartForm reads a whole multipart/form-data body. Up to maxMemory
+// bytes of files are kept in memory, larger files are written to temporary
+// files which the caller removes with RemoveAll. Fields that are not files
+// count towards Limits.MaxFormBytes.
+func (r *Request) ParseMultipartForm(maxMemory int64) (*MultipartForm, error) {
+	if r.multipartForm != nil {
+		return r.multipartForm, nil
+	}
+	if maxMemory <= 0 {
+		maxMemory = DefaultMaxMemory
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &MultipartForm{Value: url.Values{}, File: map[string][]*FileHeader{}}
+	var valueBytes int64
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		filename := part.FileName()
+		if filename == "" {
+			value, err := readLimited(part, r.limits.MaxFormBytes)
+			if err != nil {
+				form.RemoveAll()
+				return nil, err
+			}
+			valueBytes += int64(len(value))
+			if r.limits.MaxFormBytes > 0 && valueBytes > r.limits.MaxFormBytes {
+				form.RemoveAll()
+				return nil, fmt.Errorf("%w: form over %d bytes", ErrBodyTooLarge, r.limits.MaxFormBytes)
+			}
+			form.Value.Add(name, string(value))
+			continue
+		}
+
+		fh := &FileHeader{Filename: filename, Headers: part.Headers}
+		form.File[name] = append(form.File[name], fh)
+		if err := fh.store(part, &maxMemory); err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+	}
+	r.multipartForm = form
+	return form, nil
+}
+
+// store reads the content of the file, spooling it to a temporary file once
+// it no longer fits in the memory that is left.
+func (fh *FileHeader) store(part *Part, maxMemory *int64) error {
+	buf := &bytes.Buffer{}
+	n, err := io.CopyN(buf, part, *maxMemory+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n <= *maxMemory {
+		*maxMemory -= n
+		fh.content = buf.Bytes()
+		fh.Size = n
+		return nil
+	}
+
+	file, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fh.tmpFile = file.Name()
+	size, err := io.Copy(file, io.MultiReader(buf, part))
+	if err != nil {
+		return err
+	}
+	fh.Size = size
+	return file.Close()
+}
+
+// mediaType parses the Content-Type header.
+func (r *Request) mediaType() (string, map[string]string, error) {
+	contentType, ok := r.Headers.Get("content-type")
+	if !ok {
+		return "", nil, fmt.Errorf("missing Content-Type")
+	}
+	return mime.ParseMediaType(contentType)
+}
+
+// readLimited reads all of reader, failing with ErrBodyTooLarge past limit
+// bytes. A limit of 0 or less means no limit.
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(reader)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,47 @@
+package request
+
+import (
+	"errors"
+
+	"github.com/AbdKaan/httpfromtcp/internal/message"
+)
+
+// Limits bounds how much a client can make the server buffer for a single
+// request. A zero field means no limit.
+type Limits struct {
+	// MaxRequestLineBytes limits the request line, not counting the CRLF
+	MaxRequestLineBytes int
+	// MaxHeaderFieldBytes limits a single header or trailer field line
+	MaxHeaderFieldBytes int
+	// MaxHeaderBytes limits all header field lines together
+	MaxHeaderBytes int
+	// MaxHeaderCount limits the number of header field lines
+	MaxHeaderCount int
+	// MaxBodyBytes limits the body after removing its chunked framing
+	MaxBodyBytes int64
+	// MaxBufferedBodyBytes limits the body ReadBody reads into memory. A body
+	// streamed through BodyReader is only bound by MaxBodyBytes.
+	MaxBufferedBodyBytes int64
+	// MaxDecodedBodyBytes limits the body after undoing its Content-Encoding,
+	// so a small compressed body cannot expand without bound
+	MaxDecodedBodyBytes int64
+	// MaxFormBytes limits a urlencoded form body, and the fields of a
+	// multipart form that are not files
+	MaxFormBytes int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineBytes:  8 << 10,
+	MaxHeaderFieldBytes:  8 << 10,
+	MaxHeaderBytes:       64 << 10,
+	MaxHeaderCount:       100,
+	MaxBufferedBodyBytes: 10 << 20,
+	MaxDecodedBodyBytes:  10 << 20,
+	MaxFormBytes:         10 << 20,
+}
+
+var (
+	ErrRequestLineTooLong   = errors.New("request line too long")
+	ErrHeaderFieldsTooLarge = message.ErrHeaderFieldsTooLarge
+	ErrBodyTooLarge         = message.ErrBodyTooLarge
+)
@@ -0,0 +1,183 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+)
+
+// maxPartHeaderBytes bounds the header fields of a single multipart part
+const maxPartHeaderBytes = 16 << 10
+
+// MultipartReader iterates over the parts of a multipart body as they are
+// read, without buffering whole parts.
+type MultipartReader struct {
+	reader *bufio.Reader
+	// delimiter is CRLF "--" boundary, the CRLF belongs to the delimiter and
+	// not to the part before it
+	delimiter []byte
+	// part is the current part, or the preamble before the first one
+	part *Part
+	done bool
+}
+
+// Part is a single part of a multipart body. Read returns its content.
+type Part struct {
+	Headers *headers.Headers
+	reader  *MultipartReader
+	done    bool
+}
+
+// NewMultipartReader reads the multipart body in reader with the given
+// boundary.
+func NewMultipartReader(reader io.Reader, boundary string) *MultipartReader {
+	mr := &MultipartReader{
+		// The first delimiter comes without a CRLF before it, as the preamble
+		// is usually empty. Adding one lets it be matched like the others.
+		reader:    bufio.NewReader(io.MultiReader(strings.NewReader(crlf), reader)),
+		delimiter: []byte(crlf + "--" + boundary),
+	}
+	mr.part = &Part{reader: mr}
+	return mr
+}
+
+// NextPart returns the next part, skipping what is left unread of the
+// current one. It returns io.EOF after the last part.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+	if mr.done {
+		return nil, io.EOF
+	}
+	if _, err := io.Copy(io.Discard, mr.part); err != nil {
+		return nil, err
+	}
+	// The part stopped at the delimiter, which is still buffered
+	if _, err := mr.reader.Discard(len(mr.delimiter)); err != nil {
+		return nil, err
+	}
+
+	line, err := mr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, " \t")
+	if line == "--" {
+		mr.done = true
+		return nil, io.EOF
+	}
+	if line != "" {
+		return nil, fmt.Errorf("malformed multipart boundary line")
+	}
+
+	part := &Part{Headers: headers.NewHeaders(), reader: mr}
+	headerBytes := 0
+	for {
+		data, err := mr.reader.ReadSlice('\n')
+		if err != nil {
+			return nil, fmt.Errorf("error reading part headers: %w", unexpectedEOF(err))
+		}
+		headerBytes += len(data)
+		if headerBytes > maxPartHeaderBytes {
+			return nil, fmt.Errorf("%w: part headers over %d bytes", ErrHeaderFieldsTooLarge, maxPartHeaderBytes)
+		}
+		n, done, err := part.Headers.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("malformed part header line: %q", data)
+		}
+		if done {
+			break
+		}
+	}
+	mr.part = part
+	return part, nil
+}
+
+// readLine reads the rest of a boundary line without its CRLF.
+func (mr *MultipartReader) readLine() (string, error) {
+	data, err := mr.reader.ReadSlice('\n')
+	if err != nil {
+		return "", fmt.Errorf("error reading multipart boundary: %w", unexpectedEOF(err))
+	}
+	if !bytes.HasSuffix(data, []byte(crlf)) {
+		return "", fmt.Errorf("malformed multipart boundary line")
+	}
+	return string(data[:len(data)-2]), nil
+}
+
+func (p *Part) Read(b []byte) (int, error) {
+	if p.done {
+		return 0, io.EOF
+	}
+	r := p.reader.reader
+	delimiter := p.reader.delimiter
+
+	// Look at everything buffered, but at least enough to see a delimiter
+	data, err := r.Peek(max(r.Buffered(), len(delimiter)))
+	if i := bytes.Index(data, delimiter); i == 0 {
+		p.done = true
+		return 0, io.EOF
+	} else if i > 0 {
+		data = data[:i]
+	} else if err == nil {
+		// The end of the buffer may be the start of a delimiter
+		data = data[:len(data)-len(delimiter)+1]
+	} else {
+		return 0, fmt.Errorf("multipart body ended without a closing boundary: %w", unexpectedEOF(err))
+	}
+	n := copy(b, data)
+	r.Discard(n)
+	return n, nil
+}
+
+// FormName returns the name parameter of a form-data Content-Disposition.
+func (p *Part) FormName() string {
+	disposition, params := p.disposition()
+	if disposition != "form-data" {
+		return ""
+	}
+	return params["name"]
+}
+
+// FileName returns the base name of the filename parameter of the
+// Content-Disposition, so a client cannot make it point to another
+// directory. It is "" for parts that are not files.
+func (p *Part) FileName() string {
+	_, params := p.disposition()
+	filename := params["filename"]
+	if filename == "" {
+		return ""
+	}
+	filename = filepath.Base(filepath.Clean("/" + filename))
+	if filename == "/" {
+		return ""
+	}
+	return filename
+}
+
+func (p *Part) disposition() (string, map[string]string) {
+	value, ok := p.Headers.Get("content-disposition")
+	if !ok {
+		return "", nil
+	}
+	disposition, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return "", nil
+	}
+	return disposition, params
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -5,17 +5,52 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/AbdKaan/httpfromtcp/internal/chunked"
+	"github.com/AbdKaan/httpfromtcp/internal/cookie"
 	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/message"
 )
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	state       requestState
+	// Target is the parsed RequestLine.RequestTarget
+	Target  Target
+	Headers *headers.Headers
+	// Body holds the whole body once ReadBody has been called. Requests read
+	// with RequestFromReader have it filled in already.
+	Body []byte
+	// Trailers holds the trailer fields sent after a chunked body
+	Trailers *headers.Headers
+	// PathParams holds the path segments captured by a router pattern
+	PathParams map[string]string
+	// RemoteAddr is the address of the client, set by the server
+	RemoteAddr string
+	// TLS reports whether the request arrived over TLS, set by the server
+	TLS   bool
+	state requestState
+	// reader is the connection the body is read from
+	reader *Reader
+	// body parses the body framing, it is nil for requests without a body
+	body         *message.Body
+	bodyBuffered bool
+	limits       Limits
+	fields       message.Fields
+	// contentLength is the body length BodyReader gives, -1 if unknown
+	contentLength int64
+	// decodings are the content codings BodyReader undoes, decoder is the
+	// reader doing so once the body is being read
+	decodings []string
+	decoder   *decodingReader
+	// form and multipartForm cache the parsed body
+	form          url.Values
+	multipartForm *MultipartForm
+	// sendContinue is called before the body is first read, see
+	// SetContinueFunc
+	sendContinue func() error
 }
 
 type requestState int
@@ -25,6 +60,7 @@ const (
 	requestStateDone
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingBodyData
 )
 
 type RequestLine struct {
@@ -35,47 +71,193 @@ type RequestLine struct {
 
 const crlf = "\r\n"
 
-const bufferSize = 8
+// maxDiscardBytes is how much of an unread body ReadRequest skips to get to
+// the next request. Larger leftovers are cheaper to handle by closing the
+// connection.
+const maxDiscardBytes = 256 << 10
 
+var (
+	ErrBodyNotConsumed   = errors.New("previous request body was not consumed")
+	ErrExpectationFailed = errors.New("unsupported expectation")
+)
+
+// Reader reads successive requests from a single connection. Bytes read
+// past the end of one request are kept for the next one, so pipelined
+// requests on a persistent connection are not lost.
+type Reader struct {
+	// Limits applies to every request read, it defaults to DefaultLimits
+	Limits Limits
+	// DecodeContentEncoding makes BodyReader decode gzip and deflate bodies.
+	// Requests with other content codings fail with
+	// ErrUnsupportedContentEncoding.
+	DecodeContentEncoding bool
+	conn                  *message.Reader
+	// current is the last request returned, its body may still be unread
+	current *Request
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		conn:   message.NewReader(reader),
+	}
+}
+
+// RequestFromReader reads a single request including its whole body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buffer := make([]byte, bufferSize, bufferSize)
-	readToIndex := 0
-	request := Request{
-		state:   requestStateInitialized,
-		Headers: headers.NewHeaders(),
-		Body:    make([]byte, 0),
-	}
-	for request.state != requestStateDone {
-		// If the buffer is full, grow it
-		if readToIndex >= len(buffer) {
-			newBuffer := make([]byte, len(buffer)*2)
-			copy(newBuffer, buffer)
-			buffer = newBuffer
-		}
-
-		numBytesRead, err := reader.Read(buffer[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if request.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request")
-				}
-				break
-			}
-			return nil, fmt.Errorf("error reading from buffer: %v", err)
-		}
-		readToIndex += numBytesRead
+	request, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := request.ReadBody(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
 
-		numBytesParsed, err := request.parse(buffer[:readToIndex])
-		if err != nil {
-			return nil, fmt.Errorf("error parsing data: %v", err)
+// ReadRequest reads the request line and headers of the next request on the
+// connection. The body is not read, it is streamed from the connection
+// through BodyReader. If the connection fails or is closed before any byte
+// of the request arrives, the error from the underlying reader is returned
+// as is (io.EOF for a clean close).
+func (r *Reader) ReadRequest() (*Request, error) {
+	if err := r.skipBody(); err != nil {
+		return nil, err
+	}
+
+	request := &Request{
+		state:    requestStateInitialized,
+		Headers:  headers.NewHeaders(),
+		Body:     make([]byte, 0),
+		Trailers: headers.NewHeaders(),
+		reader:   r,
+		limits:   r.Limits,
+		fields: message.Fields{
+			MaxFieldBytes: r.Limits.MaxHeaderFieldBytes,
+			MaxBytes:      r.Limits.MaxHeaderBytes,
+			MaxCount:      r.Limits.MaxHeaderCount,
+		},
+	}
+	err := r.conn.ParseUntil(parser{request}, func() bool {
+		return request.state != requestStateInitialized &&
+			request.state != requestStateParsingHeaders
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.current = request
+	// 100-continue is the only expectation there is
+	if expect, ok := request.Headers.Get("expect"); ok && !strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return nil, fmt.Errorf("%w: %s", ErrExpectationFailed, expect)
+	}
+	if r.DecodeContentEncoding {
+		if err := request.decodeContentEncoding(); err != nil {
+			return nil, err
 		}
+	}
+	return request, nil
+}
+
+// WaitForRequest blocks until the first byte of the next request is
+// available, so callers can apply different timeouts to waiting for a
+// request and to reading it. Errors are returned as in ReadRequest.
+func (r *Reader) WaitForRequest() error {
+	if err := r.skipBody(); err != nil {
+		return err
+	}
+	return r.conn.Fill()
+}
+
+// skipBody discards what the handler left unread of the previous body.
+func (r *Reader) skipBody() error {
+	if r.current == nil || r.current.state == requestStateDone {
+		return nil
+	}
+	// The client may still be waiting for 100 Continue and never send the
+	// body
+	if r.current.sendContinue != nil {
+		return ErrBodyNotConsumed
+	}
+	// The body is skipped as it was sent, without undoing its content coding
+	n, err := io.CopyN(io.Discard, &bodyReader{request: r.current}, maxDiscardBytes+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n > maxDiscardBytes {
+		return ErrBodyNotConsumed
+	}
+	return nil
+}
+
+// parser adapts Request to message.Message for parsing it off the
+// connection.
+type parser struct {
+	request *Request
+}
+
+func (p parser) Parse(data []byte) (int, error) {
+	return p.request.parse(data)
+}
+
+func (p parser) Started() bool {
+	return p.request.state != requestStateInitialized
+}
 
-		// Remove the data that was successfully parsed from the buffer
-		copy(buffer, buffer[numBytesParsed:])
-		readToIndex -= numBytesParsed
+func (p parser) EOF() bool {
+	return false
+}
+
+// PathValue returns the path segment captured under name by the route that
+// matched the request, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.PathParams[name]
+}
+
+// Query returns the parsed query parameters of the request-target.
+func (r *Request) Query() url.Values {
+	return r.Target.Query()
+}
+
+// Host returns the host the request is for, taken from an absolute-form
+// request-target if there is one and the Host header otherwise.
+func (r *Request) Host() string {
+	if r.Target.Host != "" {
+		return r.Target.Host
 	}
+	host, _ := r.Headers.Get("host")
+	return host
+}
 
-	return &request, nil
+// Cookies parses the cookies of the Cookie header fields.
+func (r *Request) Cookies() []*cookie.Cookie {
+	value, ok := r.Headers.Get("cookie")
+	if !ok {
+		return nil
+	}
+	return cookie.Parse(value)
+}
+
+// Cookie returns the first cookie named name.
+func (r *Request) Cookie(name string) (*cookie.Cookie, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// ContentLength returns the length of the body BodyReader returns, or -1 if
+// it is not known up front because the body is chunked or decoded.
+func (r *Request) ContentLength() int64 {
+	return r.contentLength
+}
+
+// KeepAlive reports whether the client is willing to send further requests
+// on the same connection. HTTP/1.1 connections are persistent unless the
+// client sends "Connection: close".
+func (r *Request) KeepAlive() bool {
+	return message.KeepAlive(r.RequestLine.HttpVersion, r.Headers)
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -140,12 +322,13 @@ func requestLineFromString(str string) (*RequestLine, error) {
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
 	for r.state != requestStateDone {
+		state := r.state
 		bytesParsed, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
-			return 0, fmt.Errorf("error occured parsing headers: %v", err)
+			return 0, fmt.Errorf("error occured parsing headers: %w", err)
 		}
 		totalBytesParsed += bytesParsed
-		if bytesParsed == 0 {
+		if bytesParsed == 0 && r.state == state {
 			break
 		}
 	}
@@ -156,6 +339,10 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.state {
 	case requestStateInitialized:
+		err := message.CheckLineLength(data, r.limits.MaxRequestLineBytes, ErrRequestLineTooLong)
+		if err != nil {
+			return 0, err
+		}
 		requestLine, n, err := parseRequestLine(data)
 		if err != nil {
 			// something actually went wrong
@@ -165,11 +352,16 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			// just need more data
 			return 0, nil
 		}
+		target, err := ParseTarget(requestLine.Method, requestLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
 		r.RequestLine = *requestLine
+		r.Target = target
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		bytesParsed, done, err := r.Headers.Parse(data)
+		bytesParsed, done, err := r.fields.Parse(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
@@ -178,6 +370,20 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		}
 		return bytesParsed, nil
 	case requestStateParsingBody:
+		// Transfer-Encoding takes precedence over Content-Length
+		if transferEncoding, ok := r.Headers.Get("transfer-encoding"); ok {
+			if _, ok := r.Headers.Get("content-length"); ok {
+				return 0, fmt.Errorf("both Transfer-Encoding and Content-Length are set")
+			}
+			if !chunked.IsChunked(transferEncoding) {
+				return 0, fmt.Errorf("unsupported Transfer-Encoding: %s", transferEncoding)
+			}
+			r.contentLength = -1
+			r.body = message.NewChunkedBody(r.Trailers, &r.fields, r.limits.MaxBodyBytes)
+			r.state = requestStateParsingBodyData
+			return 0, nil
+		}
+
 		// Check if Content-Length exists
 		contentLength, ok := r.Headers.Get("content-length")
 		if !ok {
@@ -187,23 +393,31 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 
 		// Convert string Content-Length into int
 		contentLengthInt, err := strconv.Atoi(contentLength)
-		if err != nil {
-			return 0, fmt.Errorf("malformed Content-Length: %s", err)
+		if err != nil || contentLengthInt < 0 {
+			return 0, fmt.Errorf("malformed Content-Length: %s", contentLength)
 		}
-
-		// Append the data into r.Body
-		r.Body = append(r.Body, data...)
-
-		// Error if Body length is greater than Content-Length
-		if len(r.Body) > contentLengthInt {
-			return 0, fmt.Errorf("error: body length is greater than content-length")
+		if r.limits.MaxBodyBytes > 0 && int64(contentLengthInt) > r.limits.MaxBodyBytes {
+			return 0, fmt.Errorf("%w: Content-Length %d", ErrBodyTooLarge, contentLengthInt)
 		}
-
-		// Done if Body length is equal to Content-Length
-		if len(r.Body) == contentLengthInt {
+		if contentLengthInt == 0 {
 			r.state = requestStateDone
+			return 0, nil
 		}
-		return len(data), nil
+		r.contentLength = int64(contentLengthInt)
+		r.body = message.NewFixedBody(contentLengthInt, r.limits.MaxBodyBytes)
+		r.state = requestStateParsingBodyData
+		return 0, nil
+	case requestStateParsingBodyData:
+		// Anything past the body belongs to the next request on the
+		// connection
+		bytesParsed, err := r.body.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+		if r.body.Done() {
+			r.state = requestStateDone
+		}
+		return bytesParsed, nil
 	case requestStateDone:
 		return 0, fmt.Errorf("error: trying to read data in a done state")
 	default:
@@ -1,9 +1,17 @@
 package request
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,6 +78,80 @@ func TestRequestLineParse(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestTargetParse(t *testing.T) {
+	// Test: Origin form with a query
+	reader := &chunkReader{
+		data:            "GET /search/caf%C3%A9?q=go+lang&page=2 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetOrigin, r.Target.Form)
+	assert.Equal(t, "/search/café", r.Target.Path)
+	assert.Equal(t, "/search/caf%C3%A9", r.Target.RawPath)
+	assert.Equal(t, "q=go+lang&page=2", r.Target.RawQuery)
+	assert.Equal(t, "go lang", r.Query().Get("q"))
+	assert.Equal(t, "2", r.Query().Get("page"))
+	assert.Equal(t, "localhost:42069", r.Host())
+
+	// Test: Encoded slash stays encoded in the raw path
+	target, err := ParseTarget("GET", "/files/a%2Fb")
+	require.NoError(t, err)
+	assert.Equal(t, "/files/a/b", target.Path)
+	assert.Equal(t, "/files/a%2Fb", target.RawPath)
+
+	// Test: Absolute form takes the host from the target
+	reader = &chunkReader{
+		data:            "GET HTTP://example.com:8080?x=1 HTTP/1.1\r\nHost: other\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetAbsolute, r.Target.Form)
+	assert.Equal(t, "http", r.Target.Scheme)
+	assert.Equal(t, "example.com:8080", r.Host())
+	assert.Equal(t, "/", r.Target.Path)
+	assert.Equal(t, "x=1", r.Target.RawQuery)
+
+	// Test: Authority form for CONNECT
+	target, err = ParseTarget("CONNECT", "[::1]:443")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAuthority, target.Form)
+	assert.Equal(t, "[::1]:443", target.Host)
+
+	// Test: Asterisk form for OPTIONS
+	target, err = ParseTarget("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, TargetAsterisk, target.Form)
+
+	// Test: Malformed targets
+	for _, tc := range []struct{ method, target string }{
+		{"GET", "/bad%zzescape"},
+		{"GET", "/trailing%2"},
+		{"GET", "/page#section"},
+		{"GET", "/nul%00byte"},
+		{"GET", "/caf\xc3\xa9"},
+		{"GET", "*"},
+		{"GET", "relative/path"},
+		{"GET", "http://user@example.com/"},
+		{"GET", "http:///path"},
+		{"GET", "http://example.com:port/"},
+		{"CONNECT", "example.com"},
+		{"CONNECT", "/path"},
+	} {
+		_, err := ParseTarget(tc.method, tc.target)
+		assert.Error(t, err, "%s %s", tc.method, tc.target)
+	}
+
+	// Test: Malformed target fails the request
+	reader = &chunkReader{
+		data:            "GET /%G0 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
 func TestHeaderParse(t *testing.T) {
 	// Test: Standard Headers
 	reader := &chunkReader{
@@ -79,9 +161,9 @@ func TestHeaderParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", get(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", get(r.Headers, "accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -110,7 +192,22 @@ func TestHeaderParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Equal(t, "GET", r.RequestLine.Method)
-	assert.Equal(t, "localhost:42069, localhost:69420", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:69420", get(r.Headers, "host"))
+	assert.Equal(t, []string{"localhost:42069", "localhost:69420"}, r.Headers.Values("Host"))
+
+	// Test: Cookies from several Cookie headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nCookie: session=abc; theme=dark\r\nCookie: lang=en\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Len(t, r.Cookies(), 3)
+	c, ok := r.Cookie("lang")
+	require.True(t, ok)
+	assert.Equal(t, "en", c.Value)
+	_, ok = r.Cookie("missing")
+	assert.False(t, ok)
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -121,7 +218,7 @@ func TestHeaderParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Equal(t, "GET", r.RequestLine.Method)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
+	assert.Equal(t, "localhost:42069", get(r.Headers, "host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -186,6 +283,470 @@ func TestBodyParse(t *testing.T) {
 	assert.Equal(t, "", string(r.Body))
 }
 
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7;name=value\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"X-Content-Length: 13\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "13", get(r.Trailers, "x-content-length"))
+
+	// Test: Chunked body without trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"1A\r\n" +
+			"abcdefghijklmnopqrstuvwxyz\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(r.Body))
+	assert.Empty(t, r.Trailers)
+
+	// Test: Malformed chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"xyz\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Two requests on the same connection
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+
+	// Test: Clean close between requests
+	r, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, r)
+}
+
+func TestStreamingBody(t *testing.T) {
+	data := "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"6\r\n" +
+		"hello \r\n" +
+		"7\r\n" +
+		"world!\n\r\n" +
+		"0\r\n" +
+		"\r\n" +
+		"POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"\r\n" +
+		"hello world!\n" +
+		"GET / HTTP/1.1\r\n" +
+		"\r\n"
+
+	// Test: Request is returned before the body has been read
+	source := &chunkReader{data: data, numBytesPerRead: 5}
+	reader := NewReader(source)
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Less(t, source.pos, len(data)-64)
+
+	// Test: Body is decoded as it is read
+	p := make([]byte, 4)
+	n, err := io.ReadFull(r.BodyReader(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "hell", string(p[:n]))
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "o world!\n", string(body))
+
+	// Test: Unread body is skipped before the next request
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.RequestTarget)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderFieldBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+	read := func(data string) (*Request, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		r, err := reader.ReadRequest()
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	// Test: Within limits
+	r, err := read("POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Request line too long
+	_, err = read("GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n")
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Request line too long without CRLF yet
+	_, err = read("GET /" + strings.Repeat("a", 64))
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Single header field too long
+	_, err = read("GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 64) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Too many header fields
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Header fields too large in total
+	_, err = read("GET / HTTP/1.1\r\nA: " + strings.Repeat("a", 25) + "\r\nB: " + strings.Repeat("b", 25) + "\r\nC: " + strings.Repeat("c", 25) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Content-Length over the body limit
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	_, err = read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n12345\r\n5\r\n67890\r\n0\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Buffered body over the limit can still be streamed
+	limits = Limits{MaxBufferedBodyBytes: 8}
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	reader := NewReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789"))
+	reader.Limits = limits
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "123456789", string(body))
+
+	// Test: Buffered bodies are limited by default
+	assert.Positive(t, DefaultLimits.MaxBufferedBodyBytes)
+}
+
+func TestContentEncoding(t *testing.T) {
+	compress := func(coding, data string) string {
+		buf := &bytes.Buffer{}
+		var w io.WriteCloser
+		switch coding {
+		case "gzip":
+			w = gzip.NewWriter(buf)
+		case "deflate":
+			w, _ = zlib.NewWriterLevel(buf, zlib.DefaultCompression)
+		case "raw":
+			w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+		}
+		w.Write([]byte(data))
+		w.Close()
+		return buf.String()
+	}
+	request := func(coding, body string) string {
+		return "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Encoding: " + coding + "\r\n" +
+			"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+			"\r\n" + body
+	}
+	read := func(data string, limits Limits) (*Request, []byte, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 7})
+		reader.DecodeContentEncoding = true
+		reader.Limits = limits
+		r, err := reader.ReadRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := r.ReadBody()
+		return r, body, err
+	}
+	text := strings.Repeat("compressed upload ", 50)
+
+	// Test: gzip body is decoded and the headers describe the result
+	r, body, err := read(request("gzip", compress("gzip", text)), DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+	assert.Empty(t, get(r.Headers, "content-encoding"))
+	assert.Empty(t, get(r.Headers, "content-length"))
+	assert.Equal(t, int64(-1), r.ContentLength())
+
+	// Test: deflate as zlib and as a raw stream
+	_, body, err = read(request("deflate", compress("deflate", text)), DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+	_, body, err = read(request("deflate", compress("raw", text)), DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+
+	// Test: Codings are undone in reverse order
+	_, body, err = read(request("deflate, gzip", compress("gzip", compress("deflate", text))), DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+
+	// Test: Identity and empty bodies are left alone
+	r, body, err = read(request("identity", "plain"), DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(body))
+	assert.Equal(t, int64(5), r.ContentLength())
+	_, body, err = read(request("gzip", ""), DefaultLimits)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// Test: Unsupported coding
+	_, _, err = read(request("br", "data"), DefaultLimits)
+	require.ErrorIs(t, err, ErrUnsupportedContentEncoding)
+
+	// Test: Decoded size is capped
+	bomb := compress("gzip", strings.Repeat("\x00", 1<<20))
+	limits := DefaultLimits
+	limits.MaxDecodedBodyBytes = 64 << 10
+	_, _, err = read(request("gzip", bomb), limits)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Corrupt body
+	_, _, err = read(request("gzip", "not gzip"), DefaultLimits)
+	require.Error(t, err)
+
+	// Test: Without decoding the raw bytes are kept
+	raw := compress("gzip", text)
+	r, err = RequestFromReader(&chunkReader{data: request("gzip", raw), numBytesPerRead: 7})
+	require.NoError(t, err)
+	assert.Equal(t, raw, string(r.Body))
+	assert.Equal(t, "gzip", get(r.Headers, "content-encoding"))
+}
+
+func TestForm(t *testing.T) {
+	// Test: urlencoded body
+	reader := &chunkReader{
+		data:            "POST /login HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 29\r\n\r\nuser=kaan&pass=a%26b&pass=c+d",
+		numBytesPerRead: 3,
+	}
+	r, err := NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	form, err := r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, "kaan", form.Get("user"))
+	assert.Equal(t, []string{"a&b", "c d"}, form["pass"])
+
+	// Test: Other content types are not forms
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	_, err = r.Form()
+	require.ErrorIs(t, err, ErrNotForm)
+
+	// Test: Form over the limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 9\r\n\r\na=1234567",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	rr.Limits.MaxFormBytes = 8
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.Form()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestMultipart(t *testing.T) {
+	body := "preamble\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n" +
+		"\r\n" +
+		"Hello\r\nworld\r\n" +
+		"--XyZ \r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"../../notes.txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"--XyZ is not a boundary without the CRLF before it\r\n" +
+		"--XyZ--\r\n" +
+		"epilogue"
+	request := func(body string, limits Limits) *Request {
+		reader := NewReader(&chunkReader{
+			data: "POST /upload HTTP/1.1\r\n" +
+				"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+				"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body,
+			numBytesPerRead: 3,
+		})
+		reader.Limits = limits
+		r, err := reader.ReadRequest()
+		require.NoError(t, err)
+		return r
+	}
+
+	// Test: Parts are streamed with their headers
+	mr, err := request(body, DefaultLimits).MultipartReader()
+	require.NoError(t, err)
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", part.FormName())
+	assert.Equal(t, "", part.FileName())
+	data, err := io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello\r\nworld", string(data))
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "upload", part.FormName())
+	assert.Equal(t, "notes.txt", part.FileName())
+	assert.Equal(t, "text/plain", get(part.Headers, "content-type"))
+	data, err = io.ReadAll(part)
+	require.NoError(t, err)
+	assert.Equal(t, "--XyZ is not a boundary without the CRLF before it", string(data))
+	_, err = mr.NextPart()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Unread parts are skipped
+	mr, err = request(body, DefaultLimits).MultipartReader()
+	require.NoError(t, err)
+	_, err = mr.NextPart()
+	require.NoError(t, err)
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "upload", part.FormName())
+
+	// Test: Whole form with the file in memory
+	form, err := request(body, DefaultLimits).ParseMultipartForm(0)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello\r\nworld", form.Value.Get("title"))
+	require.Len(t, form.File["upload"], 1)
+	fh := form.File["upload"][0]
+	assert.Equal(t, "notes.txt", fh.Filename)
+	assert.Equal(t, int64(50), fh.Size)
+	assert.Empty(t, fh.tmpFile)
+
+	// Test: Files over maxMemory are spooled to disk
+	form, err = request(body, DefaultLimits).ParseMultipartForm(10)
+	require.NoError(t, err)
+	fh = form.File["upload"][0]
+	require.NotEmpty(t, fh.tmpFile)
+	file, err := fh.Open()
+	require.NoError(t, err)
+	data, err = io.ReadAll(file)
+	require.NoError(t, err)
+	file.Close()
+	assert.Equal(t, "--XyZ is not a boundary without the CRLF before it", string(data))
+	require.NoError(t, form.RemoveAll())
+	_, err = os.Stat(fh.tmpFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Test: Fields over the form limit
+	_, err = request(body, Limits{MaxFormBytes: 8}).ParseMultipartForm(0)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Body without a closing boundary
+	_, err = request("--XyZ\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\ncut short", DefaultLimits).ParseMultipartForm(0)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Not multipart
+	_, err = request("", DefaultLimits).Form()
+	require.ErrorIs(t, err, ErrNotForm)
+	r, err := RequestFromReader(&chunkReader{data: "POST / HTTP/1.1\r\nContent-Type: multipart/form-data\r\n\r\n", numBytesPerRead: 3})
+	require.NoError(t, err)
+	_, err = r.MultipartReader()
+	require.ErrorIs(t, err, ErrNotMultipart)
+}
+
+func get(h *headers.Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 type chunkReader struct {
 	data            string
 	numBytesPerRead int
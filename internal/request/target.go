@@ -0,0 +1,227 @@
+package request
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 section
+// 3.2.
+type TargetForm int
+
+const (
+	// TargetOrigin is a path with an optional query, "/where?q=now"
+	TargetOrigin TargetForm = iota
+	// TargetAbsolute is a full URI, as sent to proxies
+	TargetAbsolute
+	// TargetAuthority is the host and port of a CONNECT request
+	TargetAuthority
+	// TargetAsterisk is the "*" of a server-wide OPTIONS request
+	TargetAsterisk
+)
+
+// Target is a parsed request-target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set for the absolute form
+	Scheme string
+	// Host is the host and optional port of the absolute and authority
+	// forms
+	Host string
+	// Path is the percent-decoded path. RawPath is the path as sent, which
+	// keeps an encoded "/" apart from a separator.
+	Path    string
+	RawPath string
+	// RawQuery is the query without the "?", still encoded
+	RawQuery string
+}
+
+// ParseTarget parses the request-target of a request with the given method.
+// CONNECT requests must use the authority form and only OPTIONS requests may
+// use the asterisk form.
+func ParseTarget(method, target string) (Target, error) {
+	if err := checkTargetChars(target); err != nil {
+		return Target{}, err
+	}
+
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(target)
+	case target == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("asterisk-form request-target with method %s", method)
+		}
+		return Target{Form: TargetAsterisk}, nil
+	case strings.HasPrefix(target, "/"):
+		t := Target{Form: TargetOrigin}
+		if err := t.setPathAndQuery(target); err != nil {
+			return Target{}, err
+		}
+		return t, nil
+	default:
+		return parseAbsoluteForm(target)
+	}
+}
+
+// checkTargetChars rejects whitespace, control and non-ASCII bytes, a
+// fragment and malformed percent-encoding.
+func checkTargetChars(target string) error {
+	if target == "" {
+		return fmt.Errorf("empty request-target")
+	}
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		switch {
+		case c <= ' ' || c >= 0x7f:
+			return fmt.Errorf("invalid character %q in request-target", c)
+		case c == '#':
+			return fmt.Errorf("fragment in request-target: %s", target)
+		case c == '%':
+			if i+2 >= len(target) || !isHex(target[i+1]) || !isHex(target[i+2]) {
+				return fmt.Errorf("malformed percent-encoding in request-target: %s", target)
+			}
+		}
+	}
+	return nil
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// setPathAndQuery splits path-abempty [ "?" query ] and decodes the path.
+func (t *Target) setPathAndQuery(s string) error {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	if rawPath == "" {
+		rawPath = "/"
+	}
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return fmt.Errorf("malformed path in request-target: %w", err)
+	}
+	// A decoded NUL would cut the path short wherever it ends up in C or
+	// the file system
+	if strings.ContainsRune(path, 0) {
+		return fmt.Errorf("encoded NUL in request-target path")
+	}
+	t.Path = path
+	t.RawPath = rawPath
+	t.RawQuery = rawQuery
+	return nil
+}
+
+// parseAbsoluteForm parses scheme "://" authority path-abempty [ "?" query ].
+func parseAbsoluteForm(target string) (Target, error) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("malformed request-target: %s", target)
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	if err := checkAuthority(authority, false); err != nil {
+		return Target{}, err
+	}
+	t := Target{
+		Form:   TargetAbsolute,
+		Scheme: strings.ToLower(scheme),
+		Host:   authority,
+	}
+	if err := t.setPathAndQuery(rest[end:]); err != nil {
+		return Target{}, err
+	}
+	return t, nil
+}
+
+// parseAuthorityForm parses the host ":" port target of CONNECT.
+func parseAuthorityForm(target string) (Target, error) {
+	if err := checkAuthority(target, true); err != nil {
+		return Target{}, err
+	}
+	return Target{Form: TargetAuthority, Host: target}, nil
+}
+
+// checkAuthority validates a host with an optional port, the port is
+// required for CONNECT. User info is rejected, RFC 9110 forbids it in http
+// URIs.
+func checkAuthority(authority string, portRequired bool) error {
+	if authority == "" {
+		return fmt.Errorf("missing host in request-target")
+	}
+	if strings.ContainsAny(authority, "@/?") {
+		return fmt.Errorf("malformed authority in request-target: %s", authority)
+	}
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		if portRequired {
+			return fmt.Errorf("missing port in request-target: %s", authority)
+		}
+		host = authority
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+	} else if !(port == "" && !portRequired) && !validPort(port) {
+		return fmt.Errorf("malformed port in request-target: %s", authority)
+	}
+	if !validHost(host) {
+		return fmt.Errorf("malformed host in request-target: %s", authority)
+	}
+	return nil
+}
+
+// validHost accepts an IP address or a reg-name of unreserved, sub-delims
+// and percent-encoded characters.
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if strings.Contains(host, ":") {
+		return net.ParseIP(host) != nil
+	}
+	for _, c := range host {
+		isAlnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+		if !isAlnum && !strings.ContainsRune("-._~!$&'()*+,;=%", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func validPort(port string) bool {
+	if port == "" || len(port) > 5 {
+		return false
+	}
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validScheme checks scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i, c := range scheme {
+		isAlpha := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if i == 0 && !isAlpha {
+			return false
+		}
+		if !isAlpha && !('0' <= c && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// Query parses the query parameters. Malformed pairs are left out.
+func (t Target) Query() url.Values {
+	values, _ := url.ParseQuery(t.RawQuery)
+	return values
+}
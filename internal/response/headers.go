@@ -3,13 +3,24 @@ package response
 import (
 	"strconv"
 
+	"github.com/AbdKaan/httpfromtcp/internal/cookie"
 	"github.com/AbdKaan/httpfromtcp/internal/headers"
 )
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	headers := headers.NewHeaders()
 	headers.Set("Content-Length", strconv.Itoa(contentLen))
-	headers.Set("Connection", "close")
 	headers.Set("Content-Type", "text/plain")
 	return headers
 }
+
+// SetCookie adds a Set-Cookie field for c. Each cookie gets a field of its
+// own, as Set-Cookie values cannot be joined.
+func SetCookie(h *headers.Headers, c *cookie.Cookie) error {
+	value, err := c.HeaderValue()
+	if err != nil {
+		return err
+	}
+	h.Add("Set-Cookie", value)
+	return nil
+}
@@ -0,0 +1,35 @@
+package response
+
+import (
+	"errors"
+
+	"github.com/AbdKaan/httpfromtcp/internal/message"
+)
+
+// Limits bounds how much a server can make a client buffer for a single
+// response. A zero field means no limit.
+type Limits struct {
+	// MaxStatusLineBytes limits the status line, not counting the CRLF
+	MaxStatusLineBytes int
+	// MaxHeaderFieldBytes limits a single header or trailer field line
+	MaxHeaderFieldBytes int
+	// MaxHeaderBytes limits all header field lines together
+	MaxHeaderBytes int
+	// MaxHeaderCount limits the number of header field lines
+	MaxHeaderCount int
+	// MaxBodyBytes limits the body after removing its chunked framing
+	MaxBodyBytes int64
+}
+
+var DefaultLimits = Limits{
+	MaxStatusLineBytes:  8 << 10,
+	MaxHeaderFieldBytes: 8 << 10,
+	MaxHeaderBytes:      64 << 10,
+	MaxHeaderCount:      100,
+}
+
+var (
+	ErrStatusLineTooLong    = errors.New("status line too long")
+	ErrHeaderFieldsTooLarge = message.ErrHeaderFieldsTooLarge
+	ErrBodyTooLarge         = message.ErrBodyTooLarge
+)
@@ -0,0 +1,344 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/chunked"
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/message"
+)
+
+// Response is a response parsed from the wire, the counterpart of
+// request.Request.
+type Response struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+	Headers      *headers.Headers
+	// Body holds the whole body once ReadBody has been called. Responses read
+	// with ResponseFromReader have it filled in already.
+	Body []byte
+	// Trailers holds the trailer fields sent after a chunked body
+	Trailers *headers.Headers
+	state    responseState
+	// reader is the connection the body is read from
+	reader *Reader
+	// noBody is set for responses that never have a body, such as responses
+	// to HEAD requests
+	noBody bool
+	// untilClose is set when the body ends with the connection
+	untilClose bool
+	// body parses the body framing, it is nil for responses without a body
+	body         *message.Body
+	bodyBuffered bool
+	limits       Limits
+	fields       message.Fields
+}
+
+type responseState int
+
+const (
+	responseStateInitialized responseState = iota
+	responseStateDone
+	responseStateParsingHeaders
+	responseStateParsingBody
+	responseStateParsingBodyData
+)
+
+const crlf = "\r\n"
+
+// Reader reads successive responses from a single connection. Bytes read
+// past the end of one response are kept for the next one.
+type Reader struct {
+	// Limits applies to every response read, it defaults to DefaultLimits
+	Limits Limits
+	conn   *message.Reader
+	// current is the last response returned, its body may still be unread
+	current *Response
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		conn:   message.NewReader(reader),
+	}
+}
+
+// ResponseFromReader reads a single response to a request other than HEAD,
+// including its whole body.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	response, err := NewReader(reader).ReadResponse("GET")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := response.ReadBody(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ReadResponse reads the status line and headers of the next response on the
+// connection. requestMethod is the method of the request being answered,
+// which decides whether the response can have a body. Interim 1xx responses
+// are returned like any other, they never have a body. The body is not read,
+// it is streamed from the connection through BodyReader.
+func (r *Reader) ReadResponse(requestMethod string) (*Response, error) {
+	if r.current != nil && r.current.state != responseStateDone {
+		// Skip what was left of the previous body
+		if _, err := io.Copy(io.Discard, r.current.BodyReader()); err != nil {
+			return nil, err
+		}
+	}
+
+	response := &Response{
+		state:    responseStateInitialized,
+		Headers:  headers.NewHeaders(),
+		Body:     make([]byte, 0),
+		Trailers: headers.NewHeaders(),
+		reader:   r,
+		noBody:   requestMethod == "HEAD",
+		limits:   r.Limits,
+		fields: message.Fields{
+			MaxFieldBytes: r.Limits.MaxHeaderFieldBytes,
+			MaxBytes:      r.Limits.MaxHeaderBytes,
+			MaxCount:      r.Limits.MaxHeaderCount,
+		},
+	}
+	err := r.conn.ParseUntil(parser{response}, func() bool {
+		return response.state != responseStateInitialized &&
+			response.state != responseStateParsingHeaders
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.current = response
+	return response, nil
+}
+
+// Buffered returns the number of bytes read from the connection but not
+// parsed yet.
+func (r *Reader) Buffered() int {
+	return r.conn.Buffered()
+}
+
+// parser adapts Response to message.Message for parsing it off the
+// connection.
+type parser struct {
+	response *Response
+}
+
+func (p parser) Parse(data []byte) (int, error) {
+	return p.response.parse(data)
+}
+
+func (p parser) Started() bool {
+	return p.response.state != responseStateInitialized
+}
+
+func (p parser) EOF() bool {
+	r := p.response
+	if r.body == nil || !r.body.EOF() {
+		return false
+	}
+	r.state = responseStateDone
+	return true
+}
+
+// KeepAlive reports whether the server lets the connection be reused after
+// this response. HTTP/1.1 connections are persistent unless the server sends
+// "Connection: close", HTTP/1.0 ones only if it sends "Connection:
+// keep-alive".
+func (r *Response) KeepAlive() bool {
+	return !r.untilClose && message.KeepAlive(r.HttpVersion, r.Headers)
+}
+
+func (r *Response) parseStatusLine(data []byte) (int, error) {
+	idx := bytes.Index(data, []byte(crlf))
+	if idx == -1 {
+		return 0, nil
+	}
+	if err := r.statusLineFromString(string(data[:idx])); err != nil {
+		return 0, err
+	}
+	// Returns number of bytes it consumed
+	return idx + 2, nil
+}
+
+func (r *Response) statusLineFromString(str string) error {
+	// status-line   = HTTP-version SP status-code SP [ reason-phrase ]
+	// status-code   = 3DIGIT
+
+	// Example:
+	// HTTP/1.1 404 Not Found
+	parts := strings.SplitN(str, " ", 3)
+	if len(parts) < 2 {
+		return fmt.Errorf("poorly formatted status-line: %s", str)
+	}
+
+	versionParts := strings.Split(parts[0], "/")
+	if len(versionParts) != 2 || versionParts[0] != "HTTP" {
+		return fmt.Errorf("unrecognized HTTP-version: %s", parts[0])
+	}
+	if versionParts[1] != "1.1" && versionParts[1] != "1.0" {
+		return fmt.Errorf("unrecognized HTTP-version: %s", parts[0])
+	}
+
+	if len(parts[1]) != 3 || strings.Trim(parts[1], "0123456789") != "" {
+		return fmt.Errorf("invalid status code: %s", parts[1])
+	}
+	statusCode, err := strconv.Atoi(parts[1])
+	if err != nil || statusCode < 100 {
+		return fmt.Errorf("invalid status code: %s", parts[1])
+	}
+
+	r.HttpVersion = versionParts[1]
+	r.StatusCode = StatusCode(statusCode)
+	if len(parts) == 3 {
+		r.ReasonPhrase = parts[2]
+	}
+	return nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+	for r.state != responseStateDone {
+		state := r.state
+		bytesParsed, err := r.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return 0, fmt.Errorf("error occured parsing response: %w", err)
+		}
+		totalBytesParsed += bytesParsed
+		if bytesParsed == 0 && r.state == state {
+			break
+		}
+	}
+
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.state {
+	case responseStateInitialized:
+		err := message.CheckLineLength(data, r.limits.MaxStatusLineBytes, ErrStatusLineTooLong)
+		if err != nil {
+			return 0, err
+		}
+		n, err := r.parseStatusLine(data)
+		if err != nil {
+			// something actually went wrong
+			return 0, err
+		}
+		if n == 0 {
+			// just need more data
+			return 0, nil
+		}
+		r.state = responseStateParsingHeaders
+		return n, nil
+	case responseStateParsingHeaders:
+		bytesParsed, done, err := r.fields.Parse(r.Headers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			r.state = responseStateParsingBody
+		}
+		return bytesParsed, nil
+	case responseStateParsingBody:
+		// 1xx, 204 and 304 responses and responses to HEAD have no body
+		if r.noBody || r.StatusCode < 200 ||
+			r.StatusCode == StatusCodeNoContent ||
+			r.StatusCode == StatusCodeNotModified {
+			r.state = responseStateDone
+			return 0, nil
+		}
+
+		// Transfer-Encoding takes precedence over Content-Length
+		if transferEncoding, ok := r.Headers.Get("transfer-encoding"); ok {
+			if !chunked.IsChunked(transferEncoding) {
+				return 0, fmt.Errorf("unsupported Transfer-Encoding: %s", transferEncoding)
+			}
+			r.body = message.NewChunkedBody(r.Trailers, &r.fields, r.limits.MaxBodyBytes)
+			r.state = responseStateParsingBodyData
+			return 0, nil
+		}
+
+		contentLength, ok := r.Headers.Get("content-length")
+		if !ok {
+			// Without a length the body ends when the connection closes
+			r.untilClose = true
+			r.body = message.NewUntilCloseBody(r.limits.MaxBodyBytes)
+			r.state = responseStateParsingBodyData
+			return 0, nil
+		}
+		contentLengthInt, err := strconv.Atoi(contentLength)
+		if err != nil || contentLengthInt < 0 {
+			return 0, fmt.Errorf("malformed Content-Length: %s", contentLength)
+		}
+		if r.limits.MaxBodyBytes > 0 && int64(contentLengthInt) > r.limits.MaxBodyBytes {
+			return 0, fmt.Errorf("%w: Content-Length %d", ErrBodyTooLarge, contentLengthInt)
+		}
+		if contentLengthInt == 0 {
+			r.state = responseStateDone
+			return 0, nil
+		}
+		r.body = message.NewFixedBody(contentLengthInt, r.limits.MaxBodyBytes)
+		r.state = responseStateParsingBodyData
+		return 0, nil
+	case responseStateParsingBodyData:
+		bytesParsed, err := r.body.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+		if r.body.Done() {
+			r.state = responseStateDone
+		}
+		return bytesParsed, nil
+	case responseStateDone:
+		return 0, fmt.Errorf("error: trying to read data in a done state")
+	default:
+		return 0, fmt.Errorf("unknown state")
+	}
+}
+
+// bodyReader streams the body of a response from its connection.
+type bodyReader struct {
+	response *Response
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	r := b.response
+	return r.reader.conn.ReadBody(parser{r}, r.body, p)
+}
+
+// BodyReader returns a reader over the response body. The body is read from
+// the connection as the reader is consumed, so it can only be read once.
+func (r *Response) BodyReader() io.Reader {
+	if r.reader == nil || r.bodyBuffered {
+		return bytes.NewReader(r.Body)
+	}
+	return &bodyReader{response: r}
+}
+
+// ReadBody reads the rest of the body into r.Body and returns it.
+func (r *Response) ReadBody() ([]byte, error) {
+	if r.bodyBuffered {
+		return r.Body, nil
+	}
+	body, err := io.ReadAll(r.BodyReader())
+	if err != nil {
+		return nil, err
+	}
+	r.Body = append(r.Body, body...)
+	r.bodyBuffered = true
+	return r.Body, nil
+}
+
+// Done reports whether the whole response, including its body, has been
+// read from the connection.
+func (r *Response) Done() bool {
+	return r.state == responseStateDone && (r.body == nil || r.body.Pending() == 0)
+}
@@ -0,0 +1,392 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/cookie"
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	reader := &chunkReader{
+		data:            "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.1", r.HttpVersion)
+	assert.Equal(t, StatusCodeNotFound, r.StatusCode)
+	assert.Equal(t, "Not Found", r.ReasonPhrase)
+
+	// Test: Empty reason phrase
+	reader = &chunkReader{
+		data:            "HTTP/1.1 599 \r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(599), r.StatusCode)
+	assert.Equal(t, "", r.ReasonPhrase)
+
+	// Test: Invalid status code
+	reader = &chunkReader{
+		data:            "HTTP/1.1 2000 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Invalid version
+	reader = &chunkReader{
+		data:            "HTTP/2 200 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing end of headers
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestResponseBodyParse(t *testing.T) {
+	// Test: Content-Length body
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 1,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Chunked body with trailers
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7;name=value\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"X-Content-Length: 13\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	value, _ := r.Trailers.Get("X-Content-Length")
+	assert.Equal(t, "13", value)
+
+	// Test: Body delimited by the connection closing
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"read until close",
+		numBytesPerRead: 2,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "read until close", string(r.Body))
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 connections are closed unless kept alive
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.0 200 OK\r\nConnection: Keep-Alive\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Body shorter than reported content length
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: No body on 204 or in response to HEAD
+	reader = &chunkReader{
+		data: "HTTP/1.1 204 No Content\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n" +
+			"HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 4,
+	}
+	responses := NewReader(reader)
+	r, err = responses.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeNoContent, r.StatusCode)
+	assert.True(t, r.Done())
+	r, err = responses.ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeSuccess, r.StatusCode)
+	assert.True(t, r.Done())
+	r, err = responses.ReadResponse("POST")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeContinue, r.StatusCode)
+	r, err = responses.ReadResponse("POST")
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	_, err = responses.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxStatusLineBytes:  32,
+		MaxHeaderFieldBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        8,
+	}
+	read := func(data string) (*Response, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		r, err := reader.ReadResponse("GET")
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.ReadBody()
+		return r, err
+	}
+
+	// Test: Within limits
+	r, err := read("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Status line too long
+	_, err = read("HTTP/1.1 200 " + strings.Repeat("a", 64) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrStatusLineTooLong)
+
+	// Test: Single header field too long
+	_, err = read("HTTP/1.1 200 OK\r\nX-Long: " + strings.Repeat("a", 64) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Too many header fields
+	_, err = read("HTTP/1.1 200 OK\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Header fields too large in total
+	_, err = read("HTTP/1.1 200 OK\r\nA: " + strings.Repeat("a", 25) + "\r\nB: " + strings.Repeat("b", 25) + "\r\nC: " + strings.Repeat("c", 25) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Bodies over the limit
+	_, err = read("HTTP/1.1 200 OK\r\nContent-Length: 9\r\n\r\n123456789")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = read("HTTP/1.1 200 OK\r\n\r\n123456789")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	// Test: Fixed length response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeCreated))
+	h := GetDefaultHeaders(5)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+
+	r, err := ResponseFromReader(&chunkReader{data: buf.String(), numBytesPerRead: 1})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeCreated, r.StatusCode)
+	assert.Equal(t, []string{"a=1", "b=2"}, r.Headers.Values("set-cookie"))
+	assert.Equal(t, "hello", string(r.Body))
+	connection, _ := r.Headers.Get("Connection")
+	assert.Equal(t, "close", connection)
+
+	// Test: Chunked response with trailers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-Length")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-Length", "11")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.True(t, w.KeepAlive())
+
+	r, err = ResponseFromReader(&chunkReader{data: buf.String(), numBytesPerRead: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+	value, _ := r.Trailers.Get("X-Content-Length")
+	assert.Equal(t, "11", value)
+	assert.True(t, r.KeepAlive())
+
+	// Test: io.Copy into the writer frames the body by its headers
+	for _, chunked := range []bool{false, true} {
+		buf = &bytes.Buffer{}
+		w = NewWriter(buf)
+		require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+		h = GetDefaultHeaders(11)
+		if chunked {
+			h.Del("Content-Length")
+			h.Set("Transfer-Encoding", "chunked")
+		}
+		require.NoError(t, w.WriteHeaders(h))
+		n, err := io.Copy(w, strings.NewReader("hello world"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), n)
+		require.NoError(t, w.Finish())
+
+		r, err = ResponseFromReader(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(r.Body))
+	}
+}
+
+func TestWriterWithoutBody(t *testing.T) {
+	// Test: HEAD keeps Content-Length but drops the body
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: HEAD of a chunked response sends no chunks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n", buf.String())
+
+	// Test: 204 rejects a body and drops the length headers
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 304 keeps Content-Length but rejects a body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNotModified))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func TestWriteInterim(t *testing.T) {
+	// Test: Early hints before the final response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	hints := headers.NewHeaders()
+	hints.Add("Link", "</style.css>; rel=preload; as=style")
+	hints.Add("Link", "</app.js>; rel=preload; as=script")
+	require.NoError(t, w.WriteInterim(StatusCodeEarlyHints, hints))
+	require.NoError(t, w.WriteInterim(StatusCodeContinue, nil))
+	assert.False(t, w.Started())
+	require.NoError(t, w.WriteStatusLine(StatusCodeSuccess))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"Link: </app.js>; rel=preload; as=script\r\n\r\n"+
+		"HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\n"))
+
+	reader := NewReader(&chunkReader{data: buf.String(), numBytesPerRead: 4})
+	r, err := reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeEarlyHints, r.StatusCode)
+	assert.Len(t, r.Headers.Values("Link"), 2)
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeContinue, r.StatusCode)
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCodeSuccess, r.StatusCode)
+
+	// Test: Not a 1xx code, or after the final status line
+	require.Error(t, NewWriter(buf).WriteInterim(StatusCodeSuccess, nil))
+	require.Error(t, NewWriter(buf).WriteInterim(StatusCodeSwitchingProtocols, nil))
+	require.Error(t, w.WriteInterim(StatusCodeEarlyHints, nil))
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: Each cookie gets its own field
+	h := GetDefaultHeaders(0)
+	require.NoError(t, SetCookie(h, &cookie.Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, SetCookie(h, &cookie.Cookie{Name: "b", Value: "2", Path: "/"}))
+	assert.Equal(t, []string{"a=1; HttpOnly", "b=2; Path=/"}, h.Values("Set-Cookie"))
+
+	// Test: Invalid cookie is not added
+	require.Error(t, SetCookie(h, &cookie.Cookie{Name: "c", Value: "x y"}))
+	assert.Len(t, h.Values("Set-Cookie"), 2)
+}
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	// Test: Known status code
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNotFound))
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+
+	// Test: Custom reason phrase
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusCodeSuccess, "All Good"))
+	assert.Equal(t, "HTTP/1.1 200 All Good\r\n", buf.String())
+
+	// Test: Unregistered status code has an empty reason phrase
+	buf.Reset()
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(599))
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+
+	// Test: Status code out of range
+	buf.Reset()
+	w = NewWriter(buf)
+	require.Error(t, w.WriteStatusLine(99))
+	require.Error(t, w.WriteStatusLine(1000))
+	assert.Empty(t, buf.String())
+	assert.False(t, w.Started())
+
+	// Test: Reason phrase with CRLF
+	require.Error(t, w.WriteStatusLineReason(StatusCodeSuccess, "OK\r\nX-Injected: 1"))
+	assert.Empty(t, buf.String())
+
+	// Test: Status text
+	assert.Empty(t, StatusText(418))
+	assert.Equal(t, "Content Too Large", StatusText(StatusCodeContentTooLarge))
+}
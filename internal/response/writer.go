@@ -1,15 +1,43 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/message"
 )
 
 type Writer struct {
 	Writer      io.Writer
 	writerState writerState
+	// keepAlive is set by the server when the connection may be reused after
+	// this response. It is cleared if the response asks for the connection
+	// to be closed or cannot be delimited without closing it.
+	keepAlive     bool
+	chunked       bool
+	contentLength int
+	bodyWritten   int
+	statusCode    StatusCode
+	headerHooks   []func(StatusCode, *headers.Headers)
+	// newEncoder is set to transform the body, encoder is the transform
+	// in use once the headers are written
+	newEncoder func(io.Writer) Encoder
+	encoder    Encoder
+	// head is set for a response to HEAD, whose body is counted but not sent
+	head bool
+}
+
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// Encoder transforms the body before it is framed in chunks, such as a
+// gzip.Writer. Flush must write out everything written so far.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
 }
 
 func NewWriter(w io.Writer) *Writer {
@@ -23,23 +51,117 @@ const (
 	writerStateHeaders
 	writerStateBody
 	writerStateTrailers
+	writerStateDone
 )
 
+// SetKeepAlive tells the writer whether the connection may be reused after
+// the response. When it is false, "Connection: close" is sent with the
+// headers.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetRequestMethod tells the writer which request it answers. For HEAD the
+// headers are sent as they would be for GET, including Content-Length, but
+// the body the handler writes is dropped.
+func (w *Writer) SetRequestMethod(method string) {
+	w.head = method == "HEAD"
+}
+
+// KeepAlive reports whether the response was written completely and the
+// connection can be used for another request.
+func (w *Writer) KeepAlive() bool {
+	if !w.keepAlive {
+		return false
+	}
+	if w.head {
+		return w.writerState != writerStateStatusLine && w.writerState != writerStateHeaders
+	}
+	if w.chunked {
+		return w.writerState == writerStateDone
+	}
+	return w.writerState == writerStateBody && w.bodyWritten == w.contentLength
+}
+
+// OnHeaders registers fn to be called with the status code and headers right
+// before the headers are written. fn may modify the headers.
+func (w *Writer) OnHeaders(fn func(statusCode StatusCode, h *headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, fn)
+}
+
+// SetEncoder makes the body pass through the encoder newEncoder creates. It
+// has to be called before the headers are written, usually from an OnHeaders
+// hook, and makes the body chunked. Passing nil removes the encoder.
+func (w *Writer) SetEncoder(newEncoder func(io.Writer) Encoder) {
+	w.newEncoder = newEncoder
+}
+
+// StatusCode returns the status code written, or 0 if the status line has
+// not been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// Started reports whether the status line has been written. Until then the
+// handler can still choose any response.
+func (w *Writer) Started() bool {
+	return w.writerState != writerStateStatusLine
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// chunk framing.
+func (w *Writer) BytesWritten() int {
+	return w.bodyWritten
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reasonPhrase string) error {
 	if w.writerState != writerStateStatusLine {
 		return fmt.Errorf("cannot write status line in state %d", w.writerState)
 	}
+	statusLine, err := getStatusLine(statusCode, reasonPhrase)
+	if err != nil {
+		return err
+	}
+	w.statusCode = statusCode
 
 	defer func() {
 		w.writerState = writerStateHeaders
 	}()
 
-	_, err := w.Writer.Write(getStatusLine(statusCode))
+	_, err = w.Writer.Write(statusLine)
+
+	return err
+}
 
+// WriteInterim writes an informational response, such as 100 Continue or
+// 103 Early Hints, ahead of the final one. It may be called any number of
+// times before the final status line. h may be nil.
+func (w *Writer) WriteInterim(statusCode StatusCode, h *headers.Headers) error {
+	if w.writerState != writerStateStatusLine {
+		return fmt.Errorf("cannot write interim response in state %d", w.writerState)
+	}
+	// 101 hands the connection over to another protocol, it is final
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusCodeSwitchingProtocols {
+		return fmt.Errorf("invalid interim status code: %d", statusCode)
+	}
+	response, err := getStatusLine(statusCode, StatusText(statusCode))
+	if err != nil {
+		return err
+	}
+	for key, value := range h.All() {
+		response = fmt.Appendf(response, "%s: %s\r\n", key, value)
+	}
+	response = append(response, "\r\n"...)
+	_, err = w.Writer.Write(response)
 	return err
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.writerState != writerStateHeaders {
 		return fmt.Errorf("cannot write headers in state %d", w.writerState)
 	}
@@ -48,37 +170,160 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 		w.writerState = writerStateBody
 	}()
 
-	for key, value := range headers {
+	for _, hook := range w.headerHooks {
+		hook(w.statusCode, headers)
+	}
+	if !bodyAllowed(w.statusCode) {
+		// 304 may tell the length of the body a 200 would have, the others
+		// must not announce a body at all
+		if w.statusCode != StatusCodeNotModified {
+			headers.Del("Content-Length")
+		}
+		headers.Del("Transfer-Encoding")
+		w.newEncoder = nil
+	}
+	// The encoded length is not known up front
+	if w.newEncoder != nil {
+		headers.Del("Content-Length")
+		headers.Set("Transfer-Encoding", "chunked")
+	}
+	w.inspectHeaders(headers)
+	if w.newEncoder != nil && w.chunked {
+		w.encoder = w.newEncoder(chunkWriter{w})
+	}
+
+	for key, value := range headers.All() {
+		if !w.keepAlive && strings.EqualFold(key, "connection") {
+			continue
+		}
 		_, err := w.Writer.Write(fmt.Appendf(nil, "%s: %s\r\n", key, value))
 		if err != nil {
 			return fmt.Errorf("couldn't write headers: %v", err)
 		}
 	}
+	if !w.keepAlive {
+		_, err := w.Writer.Write([]byte("Connection: close\r\n"))
+		if err != nil {
+			return fmt.Errorf("couldn't write headers: %v", err)
+		}
+	}
 	_, err := w.Writer.Write([]byte("\r\n"))
 	return err
 }
 
+// inspectHeaders records how the body is delimited and whether the response
+// allows the connection to stay open.
+func (w *Writer) inspectHeaders(headers *headers.Headers) {
+	w.chunked = false
+	w.contentLength = -1
+	if message.HasToken(headers, "connection", "close") {
+		w.keepAlive = false
+	}
+	// These responses end with the headers whatever they announce
+	if !bodyAllowed(w.statusCode) {
+		w.contentLength = 0
+		return
+	}
+	if encoding, ok := headers.Get("transfer-encoding"); ok &&
+		strings.EqualFold(strings.TrimSpace(encoding), "chunked") {
+		w.chunked = true
+		return
+	}
+	if contentLength, ok := headers.Get("content-length"); ok {
+		n, err := strconv.Atoi(contentLength)
+		if err == nil && n >= 0 {
+			w.contentLength = n
+			return
+		}
+	}
+	// Without a length the client can only find the end of the body by the
+	// connection closing
+	w.keepAlive = false
+}
+
+// bodyAllowed reports whether a response with statusCode can have a body.
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != StatusCodeNoContent && statusCode != StatusCodeNotModified
+}
+
+// bodyWriter is where the body and its framing go. Nothing follows the
+// headers of a response to HEAD or of a status without a body.
+func (w *Writer) bodyWriter() io.Writer {
+	if w.head || !bodyAllowed(w.statusCode) {
+		return io.Discard
+	}
+	return w.Writer
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
 	}
-	return w.Writer.Write(p)
+	if len(p) > 0 && !bodyAllowed(w.statusCode) {
+		return 0, fmt.Errorf("%w: %d", ErrBodyNotAllowed, w.statusCode)
+	}
+	if w.encoder != nil {
+		n, err := w.encoder.Write(p)
+		w.bodyWritten += n
+		return n, err
+	}
+	n, err := w.bodyWriter().Write(p)
+	w.bodyWritten += n
+	return n, err
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.writerState != writerStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
 	}
+	if len(p) > 0 && !bodyAllowed(w.statusCode) {
+		return 0, fmt.Errorf("%w: %d", ErrBodyNotAllowed, w.statusCode)
+	}
+	// Each chunk is flushed so a streamed body still arrives as it is
+	// written
+	if w.encoder != nil {
+		n, err := w.encoder.Write(p)
+		w.bodyWritten += n
+		if err != nil {
+			return n, err
+		}
+		return n, w.encoder.Flush()
+	}
+	n, err := w.writeChunk(p)
+	if err == nil {
+		w.bodyWritten += len(p)
+	}
+	return n, err
+}
 
+// Write writes p as part of the body, as a chunk of its own if the body is
+// chunked. It lets the Writer be the destination of io.Copy.
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.chunked {
+		return w.WriteBody(p)
+	}
+	if _, err := w.WriteChunkedBody(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeChunk frames p as one chunk, an empty p is skipped as it would end
+// the body.
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
 	writtenBytesTotal := 0
 
-	n, err := fmt.Fprintf(w.Writer, "%x\r\n", len(p))
+	body := w.bodyWriter()
+	n, err := fmt.Fprintf(body, "%x\r\n", len(p))
 	if err != nil {
 		return writtenBytesTotal, fmt.Errorf("couldn't write chunked body: %v", err)
 	}
 	writtenBytesTotal += n
 
-	n, err = w.Writer.Write(fmt.Appendf(p, "\r\n"))
+	n, err = body.Write(fmt.Appendf(p[:len(p):len(p)], "\r\n"))
 	writtenBytesTotal += n
 
 	return writtenBytesTotal, err
@@ -91,20 +336,60 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	defer func() {
 		w.writerState = writerStateTrailers
 	}()
-	n, err := w.Writer.Write([]byte("0\r\n"))
+	if w.encoder != nil {
+		err := w.encoder.Close()
+		w.encoder = nil
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.bodyWriter().Write([]byte("0\r\n"))
 	return n, err
 }
 
-func (w *Writer) WriteTrailers(headers headers.Headers) error {
+// Finish ends a chunked body the handler left open with the last chunk and
+// no trailers. It does nothing for other responses.
+func (w *Writer) Finish() error {
+	if !w.chunked {
+		return nil
+	}
+	if w.writerState == writerStateBody {
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+	}
+	if w.writerState == writerStateTrailers {
+		return w.WriteTrailers(headers.NewHeaders())
+	}
+	return nil
+}
+
+func (w *Writer) WriteTrailers(headers *headers.Headers) error {
 	if w.writerState != writerStateTrailers {
 		return fmt.Errorf("cannot write trailers in state %d", w.writerState)
 	}
-	for key, value := range headers {
-		_, err := w.Writer.Write(fmt.Appendf(nil, "%s: %s\r\n", key, value))
+	defer func() {
+		w.writerState = writerStateDone
+	}()
+	body := w.bodyWriter()
+	for key, value := range headers.All() {
+		_, err := body.Write(fmt.Appendf(nil, "%s: %s\r\n", key, value))
 		if err != nil {
 			return fmt.Errorf("couldn't write trailers: %v", err)
 		}
 	}
-	_, err := w.Writer.Write([]byte("\r\n"))
+	_, err := body.Write([]byte("\r\n"))
 	return err
 }
+
+// chunkWriter frames what the encoder writes as chunks.
+type chunkWriter struct {
+	w *Writer
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.writeChunk(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,276 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/AbdKaan/httpfromtcp/internal/server"
+)
+
+// Router dispatches requests to handlers by method and path pattern.
+//
+// Patterns are made of "/" separated segments. A segment is either literal,
+// a parameter like {id} that matches any single segment, or, as the last
+// segment only, a wildcard like {path...} that matches the rest of the path.
+// A trailing "*" is a wildcard captured under the name "*". When several
+// patterns match, literal segments win over parameters and parameters win
+// over wildcards.
+//
+// GET routes also answer HEAD. OPTIONS requests without a route of their own
+// are answered with the methods the path allows, and "OPTIONS *" with every
+// method registered, although server.Serve answers it before any handler.
+type Router struct {
+	routes []route
+	// NotFound is called when no pattern matches the path. It defaults to a
+	// plain 404 response.
+	NotFound server.Handler
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+type segmentKind int
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. An empty method matches
+// every method.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: %v", err))
+	}
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func (rt *Router) Get(pattern string, handler server.Handler) {
+	rt.Handle("GET", pattern, handler)
+}
+
+func (rt *Router) Post(pattern string, handler server.Handler) {
+	rt.Handle("POST", pattern, handler)
+}
+
+func (rt *Router) Put(pattern string, handler server.Handler) {
+	rt.Handle("PUT", pattern, handler)
+}
+
+func (rt *Router) Delete(pattern string, handler server.Handler) {
+	rt.Handle("DELETE", pattern, handler)
+}
+
+// Serve is a server.Handler, pass it to server.Serve.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	if req.Target.Form == request.TargetAsterisk {
+		var methods []string
+		for _, route := range rt.routes {
+			if route.method != "" && !slices.Contains(methods, route.method) {
+				methods = append(methods, route.method)
+			}
+		}
+		options(w, methods)
+		return
+	}
+
+	method := req.RequestLine.Method
+	parts := splitPath(req.Target.RawPath)
+
+	var best *route
+	var bestParams map[string]string
+	var allowed []string
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		params, ok := route.match(parts)
+		if !ok {
+			continue
+		}
+		if !route.allows(method) {
+			if !slices.Contains(allowed, route.method) {
+				allowed = append(allowed, route.method)
+			}
+			continue
+		}
+		if best == nil || route.moreSpecific(best) {
+			best = route
+			bestParams = params
+		}
+	}
+
+	if best != nil {
+		req.PathParams = bestParams
+		best.handler(w, req)
+		return
+	}
+	if len(allowed) > 0 && method == "OPTIONS" {
+		options(w, allowed)
+		return
+	}
+	if len(allowed) > 0 {
+		methodNotAllowed(w, allowed)
+		return
+	}
+	if rt.NotFound != nil {
+		rt.NotFound(w, req)
+		return
+	}
+	notFound(w)
+}
+
+// allows reports whether the route handles method. A GET route handles HEAD
+// too, the writer leaves out the body.
+func (r *route) allows(method string) bool {
+	return r.method == "" || r.method == method || (r.method == "GET" && method == "HEAD")
+}
+
+// splitPath splits the raw path into decoded segments. An encoded "/" stays
+// inside its segment.
+func splitPath(rawPath string) []string {
+	parts := strings.Split(strings.TrimPrefix(rawPath, "/"), "/")
+	for i, part := range parts {
+		// The request parser has checked the encoding already
+		if decoded, err := url.PathUnescape(part); err == nil {
+			parts[i] = decoded
+		}
+	}
+	return parts
+}
+
+func (r *route) match(parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if segment.kind == segmentWildcard {
+			params[segment.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch segment.kind {
+		case segmentLiteral:
+			if parts[i] != segment.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[segment.value] = parts[i]
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific reports whether r should be preferred over other when both
+// match the same path. Between equal patterns a route for a single method
+// wins over one for every method.
+func (r *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind < other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.method != "" && other.method == ""
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must start with /: %s", pattern)
+	}
+	parts := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch {
+		case part == "*":
+			if !last {
+				return nil, fmt.Errorf("wildcard must be the last segment: %s", pattern)
+			}
+			segments = append(segments, segment{kind: segmentWildcard, value: "*"})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}"):
+			if !last {
+				return nil, fmt.Errorf("wildcard must be the last segment: %s", pattern)
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "...}")
+			if name == "" {
+				return nil, fmt.Errorf("missing wildcard name: %s", pattern)
+			}
+			segments = append(segments, segment{kind: segmentWildcard, value: name})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+			if name == "" {
+				return nil, fmt.Errorf("missing parameter name: %s", pattern)
+			}
+			segments = append(segments, segment{kind: segmentParam, value: name})
+		default:
+			segments = append(segments, segment{kind: segmentLiteral, value: part})
+		}
+	}
+	return segments, nil
+}
+
+func notFound(w *response.Writer) {
+	w.WriteStatusLine(response.StatusCodeNotFound)
+	body := []byte("Not Found\n")
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func methodNotAllowed(w *response.Writer, allowed []string) {
+	w.WriteStatusLine(response.StatusCodeMethodNotAllowed)
+	body := []byte("Method Not Allowed\n")
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Allow", allowHeader(allowed))
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func options(w *response.Writer, allowed []string) {
+	w.WriteStatusLine(response.StatusCodeNoContent)
+	h := headers.NewHeaders()
+	h.Set("Allow", allowHeader(allowed))
+	w.WriteHeaders(h)
+}
+
+// allowHeader lists the methods for an Allow header, adding the HEAD and
+// OPTIONS requests the router answers on its own.
+func allowHeader(methods []string) string {
+	methods = slices.Clone(methods)
+	if i := slices.Index(methods, "GET"); i != -1 && !slices.Contains(methods, "HEAD") {
+		methods = slices.Insert(methods, i+1, "HEAD")
+	}
+	if !slices.Contains(methods, "OPTIONS") {
+		methods = append(methods, "OPTIONS")
+	}
+	return strings.Join(methods, ", ")
+}
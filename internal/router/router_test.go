@@ -0,0 +1,144 @@
+package router
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	var matched string
+	var params map[string]string
+	handle := func(name string) func(*response.Writer, *request.Request) {
+		return func(w *response.Writer, req *request.Request) {
+			matched = name
+			params = req.PathParams
+		}
+	}
+	rt.Get("/users", handle("list"))
+	rt.Post("/users", handle("create"))
+	rt.Get("/users/{id}", handle("show"))
+	rt.Get("/users/me", handle("me"))
+	rt.Get("/static/{path...}", handle("static"))
+	rt.Handle("", "/files/*", handle("files"))
+	rt.Handle("", "/items", handle("any item"))
+	rt.Get("/items", handle("get item"))
+
+	serve := func(method, target string) string {
+		matched = ""
+		params = nil
+		buf := &bytes.Buffer{}
+		parsed, err := request.ParseTarget(method, target)
+		require.NoError(t, err)
+		req := &request.Request{
+			RequestLine: request.RequestLine{
+				Method:        method,
+				RequestTarget: target,
+				HttpVersion:   "1.1",
+			},
+			Target: parsed,
+		}
+		rt.Serve(response.NewWriter(buf), req)
+		return buf.String()
+	}
+
+	// Test: Literal route
+	serve("GET", "/users")
+	assert.Equal(t, "list", matched)
+	serve("POST", "/users")
+	assert.Equal(t, "create", matched)
+
+	// Test: Query string is ignored
+	serve("GET", "/users?page=2")
+	assert.Equal(t, "list", matched)
+
+	// Test: Path parameter
+	serve("GET", "/users/42")
+	assert.Equal(t, "show", matched)
+	assert.Equal(t, "42", params["id"])
+
+	// Test: Parameters are percent-decoded and an encoded slash stays in its segment
+	serve("GET", "/users/a%2Fb%20c")
+	assert.Equal(t, "show", matched)
+	assert.Equal(t, "a/b c", params["id"])
+
+	// Test: Literal segment wins over parameter
+	serve("GET", "/users/me")
+	assert.Equal(t, "me", matched)
+
+	// Test: Wildcard suffix
+	serve("GET", "/static/css/site.css")
+	assert.Equal(t, "static", matched)
+	assert.Equal(t, "css/site.css", params["path"])
+	serve("DELETE", "/files/a/b")
+	assert.Equal(t, "files", matched)
+	assert.Equal(t, "a/b", params["*"])
+
+	// Test: A route for one method wins over an earlier one for every method
+	serve("GET", "/items")
+	assert.Equal(t, "get item", matched)
+	serve("HEAD", "/items")
+	assert.Equal(t, "get item", matched)
+	serve("POST", "/items")
+	assert.Equal(t, "any item", matched)
+
+	// Test: Unknown path
+	out := serve("GET", "/nope")
+	assert.Empty(t, matched)
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Parameter does not match an empty segment
+	out = serve("GET", "/users/")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Known path, wrong method
+	out = serve("DELETE", "/users")
+	assert.Empty(t, matched)
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, POST, OPTIONS\r\n")
+
+	// Test: HEAD is served by the GET route
+	serve("HEAD", "/users/42")
+	assert.Equal(t, "show", matched)
+
+	// Test: OPTIONS lists the methods of the path
+	out = serve("OPTIONS", "/users")
+	assert.Empty(t, matched)
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, POST, OPTIONS\r\n")
+
+	// Test: OPTIONS on a route for every method goes to its handler
+	serve("OPTIONS", "/files/a")
+	assert.Equal(t, "files", matched)
+
+	// Test: OPTIONS * lists every method registered
+	out = serve("OPTIONS", "*")
+	assert.Empty(t, matched)
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, POST, OPTIONS\r\n")
+}
+
+func TestParsePattern(t *testing.T) {
+	// Test: Valid patterns
+	_, err := parsePattern("/users/{id}/posts/{rest...}")
+	require.NoError(t, err)
+	_, err = parsePattern("/")
+	require.NoError(t, err)
+
+	// Test: Missing leading slash
+	_, err = parsePattern("users")
+	require.Error(t, err)
+
+	// Test: Wildcard not at the end
+	_, err = parsePattern("/static/{path...}/x")
+	require.Error(t, err)
+
+	// Test: Empty parameter name
+	_, err = parsePattern("/users/{}")
+	require.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+// DefaultCompressMinSize is the body size below which compressing is not
+// worth it
+const DefaultCompressMinSize = 1024
+
+// encodings are the content codings Compress can produce, in order of
+// preference when the client likes several equally
+var encodings = []string{"gzip", "deflate"}
+
+// incompressibleTypes are content types that are compressed already
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+	"application/wasm",
+}
+
+// compressibleImages are image types that are text and do compress
+var compressibleImages = []string{"image/svg+xml", "image/bmp", "image/x-icon"}
+
+// Compress encodes response bodies with gzip or deflate when the client's
+// Accept-Encoding allows it. Bodies with a Content-Length below minSize,
+// compressed content types and partial responses are sent as they are.
+func Compress(minSize int) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.OnHeaders(func(statusCode response.StatusCode, h *headers.Headers) {
+				if !compressible(statusCode, h, minSize) {
+					return
+				}
+				addVary(h, "Accept-Encoding")
+				// HEAD is encoded like GET so its headers match, the writer
+				// drops the body
+				encoding := negotiateEncoding(req.Headers)
+				if encoding == "" {
+					return
+				}
+
+				h.Set("Content-Encoding", encoding)
+				// The encoded body is a different representation, byte ranges
+				// and a strong validator of the original do not apply to it
+				h.Del("Accept-Ranges")
+				if etag, ok := h.Get("ETag"); ok && strings.HasPrefix(etag, `"`) {
+					h.Set("ETag", "W/"+etag)
+				}
+				w.SetEncoder(func(dst io.Writer) response.Encoder {
+					if encoding == "gzip" {
+						return gzip.NewWriter(dst)
+					}
+					return zlib.NewWriter(dst)
+				})
+			})
+			next(w, req)
+			w.Finish()
+		}
+	}
+}
+
+// compressible reports whether a response with these headers may be
+// compressed.
+func compressible(statusCode response.StatusCode, h *headers.Headers, minSize int) bool {
+	if statusCode < 200 || statusCode == response.StatusCodeNoContent ||
+		statusCode == response.StatusCodePartialContent ||
+		statusCode == response.StatusCodeNotModified {
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	if value, ok := h.Get("Content-Length"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n < minSize {
+			return false
+		}
+	}
+	contentType, _ := h.Get("Content-Type")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, t := range compressibleImages {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// negotiateEncoding picks the supported coding with the highest q-value in
+// Accept-Encoding, or "" if identity should be sent.
+func negotiateEncoding(h *headers.Headers) string {
+	acceptEncoding, ok := h.Get("Accept-Encoding")
+	if !ok {
+		return ""
+	}
+
+	// Accept-Encoding = #( codings [ weight ] )
+	qValues := map[string]float64{}
+	wildcard := -1.0
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		if coding == "*" {
+			wildcard = q
+			continue
+		}
+		qValues[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qValues[encoding]
+		if !ok {
+			q = max(wildcard, 0)
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// addVary adds field to the Vary header unless it is listed already.
+func addVary(h *headers.Headers, field string) {
+	vary, _ := h.Get("Vary")
+	for _, name := range strings.Split(vary, ",") {
+		name = strings.TrimSpace(name)
+		if name == "*" || strings.EqualFold(name, field) {
+			return
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var longBody = strings.Repeat("hello compression ", 100)
+
+func compressRequest(acceptEncoding string) *request.Request {
+	h := headers.NewHeaders()
+	if acceptEncoding != "" {
+		h.Set("Accept-Encoding", acceptEncoding)
+	}
+	return newTestRequest(h)
+}
+
+func serveCompressed(t *testing.T, handler Handler, req *request.Request) *response.Response {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	w.SetKeepAlive(true)
+	w.SetRequestMethod(req.RequestLine.Method)
+	Compress(DefaultCompressMinSize)(handler)(w, req)
+	assert.True(t, w.KeepAlive())
+	resp, err := response.NewReader(buf).ReadResponse(req.RequestLine.Method)
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	return resp
+}
+
+func fixedHandler(contentType, body string) Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := response.GetDefaultHeaders(len(body))
+		h.Set("Content-Type", contentType)
+		h.Set("ETag", `"v1"`)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestCompress(t *testing.T) {
+	// Test: Fixed length body is gzipped and sent chunked
+	resp := serveCompressed(t, fixedHandler("text/plain", longBody), compressRequest("deflate;q=0.5, gzip"))
+	encoding, _ := resp.Headers.Get("Content-Encoding")
+	assert.Equal(t, "gzip", encoding)
+	transferEncoding, _ := resp.Headers.Get("Transfer-Encoding")
+	assert.Equal(t, "chunked", transferEncoding)
+	_, ok := resp.Headers.Get("Content-Length")
+	assert.False(t, ok)
+	vary, _ := resp.Headers.Get("Vary")
+	assert.Equal(t, "Accept-Encoding", vary)
+	etag, _ := resp.Headers.Get("ETag")
+	assert.Equal(t, `W/"v1"`, etag)
+	assert.Less(t, len(resp.Body), len(longBody))
+	gz, err := gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, longBody, string(body))
+
+	// Test: HEAD gets the headers of GET without a body
+	head := compressRequest("deflate;q=0.5, gzip")
+	head.RequestLine.Method = "HEAD"
+	headResp := serveCompressed(t, fixedHandler("text/plain", longBody), head)
+	assert.Equal(t, resp.Headers, headResp.Headers)
+	assert.Empty(t, headResp.Body)
+
+	// Test: Deflate when preferred
+	resp = serveCompressed(t, fixedHandler("text/plain", longBody), compressRequest("gzip;q=0.1, deflate"))
+	encoding, _ = resp.Headers.Get("Content-Encoding")
+	assert.Equal(t, "deflate", encoding)
+	zr, err := zlib.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, longBody, string(body))
+
+	// Test: Chunked handler body is compressed and keeps its trailers
+	chunked := func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusCodeSuccess)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Done")
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte(longBody[:900]))
+		w.WriteChunkedBody([]byte(longBody[900:]))
+		w.WriteChunkedBodyDone()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Done", "yes")
+		w.WriteTrailers(trailers)
+	}
+	resp = serveCompressed(t, chunked, compressRequest("gzip"))
+	gz, err = gzip.NewReader(bytes.NewReader(resp.Body))
+	require.NoError(t, err)
+	body, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, longBody, string(body))
+	done, _ := resp.Trailers.Get("X-Done")
+	assert.Equal(t, "yes", done)
+
+	// Test: Identity when the client does not accept a supported coding
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0, deflate;q=0", "*;q=0"} {
+		resp = serveCompressed(t, fixedHandler("text/plain", longBody), compressRequest(acceptEncoding))
+		_, ok = resp.Headers.Get("Content-Encoding")
+		assert.False(t, ok, acceptEncoding)
+		assert.Equal(t, longBody, string(resp.Body))
+		vary, _ = resp.Headers.Get("Vary")
+		assert.Equal(t, "Accept-Encoding", vary)
+	}
+
+	// Test: Small bodies and compressed types are left alone
+	resp = serveCompressed(t, fixedHandler("text/plain", "short"), compressRequest("gzip"))
+	_, ok = resp.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	_, ok = resp.Headers.Get("Vary")
+	assert.False(t, ok)
+	resp = serveCompressed(t, fixedHandler("image/png", longBody), compressRequest("gzip"))
+	_, ok = resp.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	resp = serveCompressed(t, fixedHandler("image/svg+xml", longBody), compressRequest("gzip"))
+	encoding, _ = resp.Headers.Get("Content-Encoding")
+	assert.Equal(t, "gzip", encoding)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, want := range map[string]string{
+		"gzip":                     "gzip",
+		"x-gzip":                   "gzip",
+		"deflate":                  "deflate",
+		"gzip, deflate":            "gzip",
+		"deflate, gzip;q=0.9":      "deflate",
+		"*":                        "gzip",
+		"*;q=0.5, gzip;q=0":        "deflate",
+		"br;q=1.0, gzip;q=0.8":     "gzip",
+		"gzip;q=2":                 "",
+		"identity":                 "",
+		"GZIP;Q=0.3, deflate;q=.2": "gzip",
+	} {
+		h := headers.NewHeaders()
+		h.Set("Accept-Encoding", acceptEncoding)
+		assert.Equal(t, want, negotiateEncoding(h), acceptEncoding)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks an address given to Listen as a Unix socket path
+const unixPrefix = "unix:"
+
+// Listen opens a listener for address, which is a TCP "host:port" such as
+// ":42069" or "127.0.0.1:0", or a Unix socket written as "unix:/path".
+func Listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		return ListenUnix(path)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the listener on %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// ListenUnix opens a listener on a Unix socket. A socket file left behind by
+// a previous run is removed first, the socket is removed again when the
+// listener is closed.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("error creating the listener on %s: file exists and is not a socket", path)
+		}
+		// Only remove the socket if nothing answers on it
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("error creating the listener on %s: socket is in use", path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error removing stale socket %s: %w", path, err)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the listener on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// ListenAndServe opens a listener for address as Listen does and serves on
+// it.
+func ListenAndServe(handler Handler, address string, opts ...Option) (*Server, error) {
+	listener, err := Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	return Serve(handler, listener, opts...), nil
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler with behavior that runs around it.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with the given middleware. The first middleware is the
+// outermost one, so it sees the request first and the response last.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Logger logs the method, target, status code, body size and duration of
+// every request.
+func Logger(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			logger.Printf(
+				"%s %s %d %dB %v",
+				req.RequestLine.Method,
+				req.RequestLine.RequestTarget,
+				w.StatusCode(),
+				w.BytesWritten(),
+				time.Since(start),
+			)
+		}
+	}
+}
+
+// Recoverer turns a panic in the handler into a 500 response if nothing has
+// been written yet. The panic is logged with its stack trace.
+func Recoverer() Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				if v := recover(); v != nil {
+					logPanic(req, v)
+					if !w.Started() {
+						writeError(w, response.StatusCodeInternalServerError, "Internal Server Error\n")
+					}
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// SetHeaders adds the given headers to every response, replacing any value
+// the handler set for the same field.
+func SetHeaders(h *headers.Headers) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.OnHeaders(func(_ response.StatusCode, responseHeaders *headers.Headers) {
+				for key := range h.All() {
+					responseHeaders.Del(key)
+				}
+				for key, value := range h.All() {
+					responseHeaders.Add(key, value)
+				}
+			})
+			next(w, req)
+		}
+	}
+}
+
+// BasicAuth rejects requests without valid Basic credentials with a 401.
+func BasicAuth(realm string, check func(user, password string) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			user, password, ok := basicAuth(req)
+			if !ok || !check(user, password) {
+				w.OnHeaders(func(_ response.StatusCode, h *headers.Headers) {
+					h.Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+				})
+				writeError(w, response.StatusCodeUnauthorized, "Unauthorized\n")
+				return
+			}
+			next(w, req)
+		}
+	}
+}
+
+// BasicAuthCredentials returns a check for BasicAuth that accepts a single
+// user and password.
+func BasicAuthCredentials(user, password string) func(string, string) bool {
+	return func(u, p string) bool {
+		userMatch := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		return userMatch && passwordMatch
+	}
+}
+
+func basicAuth(req *request.Request) (string, string, bool) {
+	authorization, ok := req.Headers.Get("authorization")
+	if !ok {
+		return "", "", false
+	}
+	scheme, credentials, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.WriteStatusLine(statusCode)
+	body := []byte(message)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
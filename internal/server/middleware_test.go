@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRequest(h *headers.Headers) *request.Request {
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	return &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     h,
+	}
+}
+
+func okHandler(w *response.Writer, _ *request.Request) {
+	writeError(w, response.StatusCodeSuccess, "ok")
+}
+
+func TestChain(t *testing.T) {
+	// Test: First middleware is the outermost
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				order = append(order, name+" in")
+				next(w, req)
+				order = append(order, name+" out")
+			}
+		}
+	}
+	handler := Chain(okHandler, trace("a"), trace("b"))
+	w := response.NewWriter(&bytes.Buffer{})
+	handler(w, newTestRequest(nil))
+	assert.Equal(t, []string{"a in", "b in", "b out", "a out"}, order)
+	assert.Equal(t, response.StatusCodeSuccess, w.StatusCode())
+	assert.Equal(t, 2, w.BytesWritten())
+}
+
+func TestBuiltinMiddleware(t *testing.T) {
+	// Test: Recoverer writes a 500
+	buf := &bytes.Buffer{}
+	handler := Chain(func(*response.Writer, *request.Request) {
+		panic("boom")
+	}, Recoverer())
+	handler(response.NewWriter(buf), newTestRequest(nil))
+	assert.Contains(t, buf.String(), "HTTP/1.1 500 Internal Server Error\r\n")
+
+	// Test: SetHeaders injects headers
+	injected := headers.NewHeaders()
+	injected.Set("X-Frame-Options", "DENY")
+	buf = &bytes.Buffer{}
+	handler = Chain(okHandler, SetHeaders(injected))
+	handler(response.NewWriter(buf), newTestRequest(nil))
+	assert.Contains(t, buf.String(), "X-Frame-Options: DENY\r\n")
+
+	// Test: BasicAuth rejects missing credentials
+	auth := BasicAuth("test", BasicAuthCredentials("user", "secret"))
+	buf = &bytes.Buffer{}
+	Chain(okHandler, auth)(response.NewWriter(buf), newTestRequest(nil))
+	assert.Contains(t, buf.String(), "HTTP/1.1 401 Unauthorized\r\n")
+	assert.Contains(t, buf.String(), "WWW-Authenticate: Basic realm=\"test\"\r\n")
+
+	// Test: BasicAuth accepts valid credentials
+	h := headers.NewHeaders()
+	h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")))
+	buf = &bytes.Buffer{}
+	Chain(okHandler, auth)(response.NewWriter(buf), newTestRequest(h))
+	assert.Contains(t, buf.String(), "HTTP/1.1 200 OK\r\n")
+}
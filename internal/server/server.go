@@ -1,24 +1,136 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/AbdKaan/httpfromtcp/internal/headers"
 	"github.com/AbdKaan/httpfromtcp/internal/request"
 	"github.com/AbdKaan/httpfromtcp/internal/response"
 )
 
+const (
+	defaultIdleTimeout        = 60 * time.Second
+	defaultReadHeaderTimeout  = 10 * time.Second
+	defaultMaxRequestsPerConn = 100
+	shutdownPollInterval      = 50 * time.Millisecond
+	// allowedMethods is the Allow header of the server's answer to
+	// "OPTIONS *"
+	allowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+)
+
 type Server struct {
 	listener net.Listener
 	closed   atomic.Bool
 	handler  Handler
+
+	// conns tracks open connections so Shutdown can drain them
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+
+	idleTimeout        time.Duration
+	readHeaderTimeout  time.Duration
+	readBodyTimeout    time.Duration
+	writeTimeout       time.Duration
+	maxRequestsPerConn int
+	bufferBodies       bool
+	decodeBodies       bool
+	limits             request.Limits
 }
 
+type connState int
+
+const (
+	// connStateIdle is a connection waiting for its next request
+	connStateIdle connState = iota
+	// connStateActive is a connection with a request being handled
+	connStateActive
+)
+
 type Handler func(w *response.Writer, req *request.Request)
 
+// Option configures a Server created by Serve.
+type Option func(*Server)
+
+// WithIdleTimeout sets how long a persistent connection may wait for the
+// next request before it is closed. Zero disables the timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout sets how long a client has to send the request line
+// and headers once the request has started. Clients that are too slow get a
+// 408 Request Timeout. Zero disables the timeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithReadBodyTimeout sets how long the handler has to read the request body
+// once the headers are read. Zero disables the timeout.
+func WithReadBodyTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readBodyTimeout = d
+	}
+}
+
+// WithWriteTimeout sets how long writing the response may take once the
+// headers are read. Zero disables the timeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn limits how many requests are served on a single
+// connection before it is closed. Zero means no limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(s *Server) {
+		s.maxRequestsPerConn = n
+	}
+}
+
+// WithBufferedBodies makes the server read the whole request body into
+// Request.Body before calling the handler, up to
+// Limits.MaxBufferedBodyBytes. By default handlers stream the body with
+// Request.BodyReader.
+func WithBufferedBodies(enabled bool) Option {
+	return func(s *Server) {
+		s.bufferBodies = enabled
+	}
+}
+
+// WithDecodedBodies makes request bodies sent with a gzip or deflate
+// Content-Encoding reach the handler decoded. Requests with any other
+// coding are answered with 415. The decoded size is capped by
+// Limits.MaxDecodedBodyBytes.
+func WithDecodedBodies(enabled bool) Option {
+	return func(s *Server) {
+		s.decodeBodies = enabled
+	}
+}
+
+// WithLimits sets the size limits applied to every request. Requests over a
+// limit are answered with 414, 431 or 413.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
 type HandlerError struct {
 	StatusCode response.StatusCode
 	Message    string
@@ -33,19 +145,35 @@ func (h HandlerError) Write(w io.Writer) {
 	w.Write(messageBytes)
 }
 
-func Serve(handler Handler, port int) (*Server, error) {
-	address := fmt.Sprintf(":%d", port)
-	listener, err := net.Listen("tcp", address)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"error occured creating the listener on port %v: %v",
-			port,
-			err,
-		)
+// Serve handles the connections accepted by listener in the background. The
+// listener is closed by Close and Shutdown.
+func Serve(handler Handler, listener net.Listener, opts ...Option) *Server {
+	return newServer(listener, handler, opts)
+}
+
+// newServer applies the options and starts accepting connections on
+// listener.
+func newServer(listener net.Listener, handler Handler, opts []Option) *Server {
+	server := &Server{
+		listener:           listener,
+		handler:            handler,
+		conns:              map[net.Conn]connState{},
+		idleTimeout:        defaultIdleTimeout,
+		readHeaderTimeout:  defaultReadHeaderTimeout,
+		limits:             request.DefaultLimits,
+		maxRequestsPerConn: defaultMaxRequestsPerConn,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
-	server := &Server{listener: listener, handler: handler}
 	go server.listen()
-	return server, nil
+	return server
+}
+
+// Addr returns the address the server accepts connections on, which has the
+// actual port when listening on port 0.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
 func (s *Server) Close() error {
@@ -56,6 +184,67 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Shutdown stops accepting connections, closes idle ones and waits for
+// active requests to finish. If ctx is done first, the remaining connections
+// are closed forcibly. It returns how many connections had to be forcibly
+// closed.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	err := s.Close()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() == 0 {
+			return 0, err
+		}
+		select {
+		case <-ctx.Done():
+			return s.closeAllConns(), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections waiting for a request and returns how
+// many active ones remain.
+func (s *Server) closeIdleConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for conn, state := range s.conns {
+		if state == connStateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+			continue
+		}
+		active++
+	}
+	return active
+}
+
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return n
+}
+
+func (s *Server) setConnState(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = state
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
 func (s *Server) listen() {
 	for {
 		// Wait for a connection
@@ -74,15 +263,156 @@ func (s *Server) listen() {
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	writer := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		writer.WriteStatusLine(response.StatusCodeBadRequest)
-		body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-		writer.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		writer.WriteBody(body)
-		return
-	}
-	s.handler(writer, req)
-	return
+	defer s.removeConn(conn)
+	reader := request.NewReader(conn)
+	reader.Limits = s.limits
+	reader.DecodeContentEncoding = s.decodeBodies
+	for served := 0; ; served++ {
+		s.setConnState(conn, connStateIdle)
+		if s.closed.Load() {
+			return
+		}
+		conn.SetReadDeadline(deadline(s.idleTimeout))
+		if err := reader.WaitForRequest(); err != nil {
+			// The client closed the connection or went idle between requests,
+			// or left too much of the previous body unread to skip
+			return
+		}
+		s.setConnState(conn, connStateActive)
+
+		conn.SetReadDeadline(deadline(s.readHeaderTimeout))
+		req, err := reader.ReadRequest()
+		if err != nil {
+			if s.closed.Load() {
+				return
+			}
+			// The write deadline of the previous request may have passed
+			conn.SetWriteDeadline(deadline(s.writeTimeout))
+			writer := response.NewWriter(conn)
+			if errors.Is(err, request.ErrUnsupportedContentEncoding) {
+				writer.OnHeaders(func(_ response.StatusCode, h *headers.Headers) {
+					h.Set("Accept-Encoding", request.SupportedContentEncodings)
+				})
+			}
+			writeError(
+				writer,
+				statusCodeForError(err),
+				fmt.Sprintf("Error parsing request: %v", err),
+			)
+			return
+		}
+		req.RemoteAddr = conn.RemoteAddr().String()
+		_, req.TLS = conn.(*tls.Conn)
+		conn.SetReadDeadline(deadline(s.readBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.writeTimeout))
+
+		writer := response.NewWriter(conn)
+		writer.SetRequestMethod(req.RequestLine.Method)
+		if req.ExpectsContinue() {
+			continued := false
+			req.SetContinueFunc(func() error {
+				continued = true
+				return writer.WriteInterim(response.StatusCodeContinue, nil)
+			})
+			writer.OnHeaders(func(_ response.StatusCode, h *headers.Headers) {
+				// The client may never send the body it was not asked for,
+				// so the connection cannot be reused
+				if !continued {
+					h.Set("Connection", "close")
+				}
+			})
+		}
+		if s.bufferBodies {
+			if _, err := req.ReadBody(); err != nil {
+				writeError(
+					writer,
+					statusCodeForError(err),
+					fmt.Sprintf("Error reading request body: %v", err),
+				)
+				return
+			}
+		}
+		lastRequest := s.maxRequestsPerConn > 0 && served+1 >= s.maxRequestsPerConn
+		writer.SetKeepAlive(req.KeepAlive() && !lastRequest && !s.closed.Load())
+		writer.OnHeaders(func(_ response.StatusCode, h *headers.Headers) {
+			// Shutdown started while the handler was running
+			if s.closed.Load() {
+				h.Set("Connection", "close")
+			}
+		})
+		if req.Target.Form == request.TargetAsterisk {
+			// "OPTIONS *" asks about the server as a whole rather than a
+			// resource, so it is not for the handler
+			writer.WriteStatusLine(response.StatusCodeNoContent)
+			h := headers.NewHeaders()
+			h.Set("Allow", allowedMethods)
+			writer.WriteHeaders(h)
+		} else if !s.serve(conn, writer, req) {
+			return
+		}
+		if !writer.KeepAlive() {
+			return
+		}
+	}
+}
+
+// statusCodeForError picks the status code for a request that could not be
+// read.
+func statusCodeForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return response.StatusCodeRequestTimeout
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusCodeURITooLong
+	case errors.Is(err, request.ErrHeaderFieldsTooLarge):
+		return response.StatusCodeRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusCodeContentTooLarge
+	case errors.Is(err, request.ErrUnsupportedContentEncoding):
+		return response.StatusCodeUnsupportedMediaType
+	case errors.Is(err, request.ErrExpectationFailed):
+		return response.StatusCodeExpectationFailed
+	default:
+		return response.StatusCodeBadRequest
+	}
+}
+
+// deadline returns the deadline for a timeout starting now, or the zero time
+// (no deadline) if the timeout is disabled.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// serve runs the handler and recovers from a panic in it. If nothing was
+// written yet the client gets a 500, otherwise the response is cut short by
+// closing the connection. It reports whether the handler returned normally.
+func (s *Server) serve(conn net.Conn, w *response.Writer, req *request.Request) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			logPanic(req, v)
+			ok = false
+			if !w.Started() {
+				// A fresh writer for the same request, as the handler's may
+				// have been left with hooks or an encoder set
+				writer := response.NewWriter(conn)
+				writer.SetRequestMethod(req.RequestLine.Method)
+				writeError(writer, response.StatusCodeInternalServerError, "Internal Server Error\n")
+			}
+		}
+	}()
+	s.handler(w, req)
+	return true
+}
+
+func logPanic(req *request.Request, v any) {
+	log.Printf(
+		"panic serving %s %s: %v\n%s",
+		req.RequestLine.Method,
+		req.RequestLine.RequestTarget,
+		v,
+		debug.Stack(),
+	)
 }
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return listener
+}
+
+// roundTrip sends a request that closes the connection and reads the
+// response.
+func roundTrip(t *testing.T, network, address string) *response.Response {
+	conn, err := net.Dial(network, address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := response.ResponseFromReader(conn)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestServeListener(t *testing.T) {
+	handler := func(w *response.Writer, _ *request.Request) {
+		writeError(w, response.StatusCodeSuccess, "ok")
+	}
+
+	// Test: Address string with port 0 reports the bound port
+	s, err := ListenAndServe(handler, "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := s.Addr().(*net.TCPAddr)
+	assert.NotZero(t, addr.Port)
+	assert.Equal(t, "ok", string(roundTrip(t, "tcp", addr.String()).Body))
+	require.NoError(t, s.Close())
+
+	// Test: Unix socket
+	path := filepath.Join(t.TempDir(), "server.sock")
+	s, err = ListenAndServe(handler, "unix:"+path)
+	require.NoError(t, err)
+	assert.Equal(t, path, s.Addr().String())
+	assert.Equal(t, "ok", string(roundTrip(t, "unix", path).Body))
+
+	// Test: A socket in use is not taken over
+	_, err = ListenUnix(path)
+	require.Error(t, err)
+	require.NoError(t, s.Close())
+
+	// Test: A stale socket file is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	listener, err := ListenUnix(path)
+	require.NoError(t, err)
+	listener.Close()
+
+	// Test: Serve on an existing listener
+	listener = newListener(t)
+	s = Serve(handler, listener)
+	assert.Equal(t, listener.Addr(), s.Addr())
+	assert.Equal(t, "ok", string(roundTrip(t, "tcp", listener.Addr().String()).Body))
+	require.NoError(t, s.Close())
+
+	// Test: Bad address
+	_, err = ListenAndServe(handler, "127.0.0.1:http-ish")
+	require.Error(t, err)
+}
+
+func TestExpectContinue(t *testing.T) {
+	bodyErr := make(chan error, 1)
+	s := Serve(func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/reject" {
+			writeError(w, response.StatusCodeContentTooLarge, "too large")
+			return
+		}
+		body, err := req.ReadBody()
+		bodyErr <- err
+		if err != nil {
+			return
+		}
+		writeError(w, response.StatusCodeSuccess, string(body))
+	}, newListener(t))
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := response.NewReader(conn)
+
+	// Test: 100 Continue is sent once the handler reads the body
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := reader.ReadResponse("POST")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeContinue, resp.StatusCode)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, <-bodyErr)
+	resp, err = reader.ReadResponse("POST")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+	assert.True(t, resp.KeepAlive())
+
+	// Test: Rejected without 100 Continue, the connection is closed
+	_, err = conn.Write([]byte("POST /reject HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("POST")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeContentTooLarge, resp.StatusCode)
+	assert.False(t, resp.KeepAlive())
+
+	// Test: Unknown expectation
+	conn, err = net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: teapot\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = response.ResponseFromReader(conn)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeExpectationFailed, resp.StatusCode)
+}
+
+func TestHeadRequest(t *testing.T) {
+	s := Serve(func(w *response.Writer, _ *request.Request) {
+		writeError(w, response.StatusCodeSuccess, "hello")
+	}, newListener(t))
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := response.NewReader(conn)
+
+	// Test: HEAD gets the headers of GET without the body
+	_, err = conn.Write([]byte("HEAD / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := reader.ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	contentLength, _ := resp.Headers.Get("Content-Length")
+	assert.Equal(t, "5", contentLength)
+	assert.True(t, resp.KeepAlive())
+
+	// Test: The next response follows right after the headers
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+// dial opens a connection to the server and a reader for its responses.
+func dial(t *testing.T, s *Server) (net.Conn, *response.Reader) {
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, response.NewReader(conn)
+}
+
+func TestTimeouts(t *testing.T) {
+	bodyErr := make(chan error, 1)
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/upload" {
+			_, err := req.ReadBody()
+			bodyErr <- err
+			if err != nil {
+				return
+			}
+		}
+		writeError(w, response.StatusCodeSuccess, "ok")
+	}
+	s := Serve(handler, newListener(t),
+		WithReadHeaderTimeout(200*time.Millisecond),
+		WithReadBodyTimeout(100*time.Millisecond),
+		WithWriteTimeout(100*time.Millisecond),
+		WithIdleTimeout(time.Second),
+	)
+	defer s.Close()
+
+	// Test: Slow headers get a 408, even after the previous write deadline
+	conn, reader := dial(t, s)
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := reader.ReadResponse("GET")
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	time.Sleep(150 * time.Millisecond)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: loc"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeRequestTimeout, resp.StatusCode)
+	assert.False(t, resp.KeepAlive())
+
+	// Test: Slow body fails the handler's read
+	conn, _ = dial(t, s)
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhe"))
+	require.NoError(t, err)
+	select {
+	case err := <-bodyErr:
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("body read did not time out")
+	}
+
+	// Test: Idle connection is closed
+	s = Serve(handler, newListener(t), WithIdleTimeout(100*time.Millisecond))
+	defer s.Close()
+	conn, _ = dial(t, s)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	s := Serve(func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("handler failed")
+		case "/partial":
+			w.WriteStatusLine(response.StatusCodeSuccess)
+			w.WriteHeaders(response.GetDefaultHeaders(10))
+			w.WriteBody([]byte("hello"))
+			panic("handler failed midway")
+		}
+		writeError(w, response.StatusCodeSuccess, "ok")
+	}, newListener(t))
+	defer s.Close()
+
+	// Test: Panic before anything was written is a 500
+	conn, reader := dial(t, s)
+	_, err := conn.Write([]byte("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeInternalServerError, resp.StatusCode)
+	assert.False(t, resp.KeepAlive())
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	_, err = reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: The 500 for a HEAD request has no body
+	conn, reader = dial(t, s)
+	_, err = conn.Write([]byte("HEAD /panic HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeInternalServerError, resp.StatusCode)
+	length, _ := resp.Headers.Get("Content-Length")
+	assert.Equal(t, "22", length)
+	_, err = reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Panic after the headers were sent cuts the response short
+	conn, reader = dial(t, s)
+	_, err = conn.Write([]byte("GET /partial HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	_, err = resp.ReadBody()
+	require.Error(t, err)
+
+	// Test: The server keeps serving other connections
+	assert.Equal(t, "ok", string(roundTrip(t, "tcp", s.Addr().String()).Body))
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		writeError(w, response.StatusCodeSuccess, "ok")
+	}
+
+	// Test: Active request is drained and told to close the connection
+	s := Serve(handler, newListener(t))
+	conn, reader := dial(t, s)
+	_, err := conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	type result struct {
+		forced int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		forced, err := s.Shutdown(context.Background())
+		done <- result{forced, err}
+	}()
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	resp, err := reader.ReadResponse("GET")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.False(t, resp.KeepAlive())
+	res := <-done
+	require.NoError(t, res.err)
+	assert.Equal(t, 0, res.forced)
+
+	// Test: Idle keep-alive connection is closed right away
+	s = Serve(handler, newListener(t))
+	conn, reader = dial(t, s)
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	_, err = resp.ReadBody()
+	require.NoError(t, err)
+	assert.True(t, resp.KeepAlive())
+	forced, err := s.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, forced)
+	_, err = reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Requests still running when ctx expires are closed forcibly
+	s = Serve(handler, newListener(t))
+	release = make(chan struct{})
+	defer close(release)
+	conn, reader = dial(t, s)
+	_, err = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	forced, err = s.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, forced)
+	_, err = reader.ReadResponse("GET")
+	require.Error(t, err)
+}
+
+func TestKeepAlive(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		writeError(w, response.StatusCodeSuccess, req.RequestLine.RequestTarget)
+	}
+	get := func(conn net.Conn, reader *response.Reader, target string, extra string) *response.Response {
+		_, err := conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n" + extra + "\r\n"))
+		require.NoError(t, err)
+		resp, err := reader.ReadResponse("GET")
+		require.NoError(t, err)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+		return resp
+	}
+	s := Serve(handler, newListener(t), WithMaxRequestsPerConn(3), WithIdleTimeout(200*time.Millisecond))
+	defer s.Close()
+
+	// Test: Several requests on one connection
+	conn, reader := dial(t, s)
+	assert.True(t, get(conn, reader, "/one", "").KeepAlive())
+	assert.True(t, get(conn, reader, "/two", "").KeepAlive())
+
+	// Test: The last request allowed on a connection closes it
+	assert.False(t, get(conn, reader, "/three", "").KeepAlive())
+	_, err := reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection: close from the client is honored
+	conn, reader = dial(t, s)
+	assert.False(t, get(conn, reader, "/bye", "Connection: close\r\n").KeepAlive())
+	_, err = reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection left idle after a request is closed
+	conn, reader = dial(t, s)
+	assert.True(t, get(conn, reader, "/idle", "").KeepAlive())
+	start := time.Now()
+	_, err = reader.ReadResponse("GET")
+	require.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestOptionsAsterisk(t *testing.T) {
+	s := Serve(func(w *response.Writer, _ *request.Request) {
+		writeError(w, response.StatusCodeSuccess, "handler")
+	}, newListener(t))
+	defer s.Close()
+	conn, reader := dial(t, s)
+
+	// Test: The server answers OPTIONS * without the handler
+	_, err := conn.Write([]byte("OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := reader.ReadResponse("OPTIONS")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCodeNoContent, resp.StatusCode)
+	allow, _ := resp.Headers.Get("Allow")
+	assert.Contains(t, allow, "OPTIONS")
+	assert.True(t, resp.Done())
+	assert.True(t, resp.KeepAlive())
+
+	// Test: Other requests on the connection still reach the handler
+	_, err = conn.Write([]byte("OPTIONS / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = reader.ReadResponse("OPTIONS")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "handler", string(body))
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often the certificate files are checked for
+// changes, at most once per interval and only when a client connects
+var certReloadInterval = 5 * time.Second
+
+// ServeTLS is Serve for HTTPS with the certificate and key in PEM files. The
+// files are reloaded when they change, so renewed certificates are picked up
+// without a restart.
+func ServeTLS(handler Handler, listener net.Listener, certFile, keyFile string, opts ...Option) (*Server, error) {
+	certs := NewCertificates()
+	if err := certs.Add(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return ServeTLSConfig(handler, listener, &tls.Config{GetCertificate: certs.GetCertificate}, opts...)
+}
+
+// ServeTLSConfig is Serve for HTTPS with the given TLS configuration. Use
+// Certificates as its GetCertificate to serve several hosts. The config is
+// cloned and made to advertise only http/1.1 through ALPN.
+func ServeTLSConfig(handler Handler, listener net.Listener, config *tls.Config, opts ...Option) (*Server, error) {
+	config = config.Clone()
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, fmt.Errorf("TLS config has no certificate")
+	}
+	// Other protocols such as h2 are not served, a client that negotiated
+	// one would not be understood
+	config.NextProtos = []string{"http/1.1"}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	return newServer(tls.NewListener(listener, config), handler, opts), nil
+}
+
+// Certificates holds certificates loaded from files and picks the one for
+// the host a client asks for with SNI. The first certificate added is used
+// when none matches.
+type Certificates struct {
+	mu          sync.Mutex
+	pairs       []*certPair
+	lastChecked time.Time
+}
+
+// certPair is a certificate with the files it was loaded from.
+type certPair struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func NewCertificates() *Certificates {
+	return &Certificates{lastChecked: time.Now()}
+}
+
+// Add loads a certificate and key from PEM files.
+func (c *Certificates) Add(certFile, keyFile string) error {
+	pair := &certPair{certFile: certFile, keyFile: keyFile}
+	if err := pair.load(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pairs = append(c.pairs, pair)
+	return nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pairs) == 0 {
+		return nil, fmt.Errorf("no certificates loaded")
+	}
+	if time.Since(c.lastChecked) >= certReloadInterval {
+		c.lastChecked = time.Now()
+		c.reload()
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name != "" {
+		for _, pair := range c.pairs {
+			if pair.cert.Leaf != nil && pair.cert.Leaf.VerifyHostname(name) == nil {
+				return pair.cert, nil
+			}
+		}
+	}
+	return c.pairs[0].cert, nil
+}
+
+// reload loads the files that changed since they were last loaded. A pair
+// that fails to load keeps its previous certificate, as the files may be
+// in the middle of being replaced.
+func (c *Certificates) reload() {
+	for _, pair := range c.pairs {
+		modTimes, err := pair.stat()
+		if err != nil || modTimes == pair.modTimes {
+			continue
+		}
+		if err := pair.load(); err != nil {
+			log.Printf("Error reloading certificate %s: %v", pair.certFile, err)
+			continue
+		}
+		log.Printf("Reloaded certificate %s", pair.certFile)
+	}
+}
+
+func (p *certPair) load() error {
+	modTimes, err := p.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate %s: %w", p.certFile, err)
+	}
+	p.cert = &cert
+	p.modTimes = modTimes
+	return nil
+}
+
+func (p *certPair) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{p.certFile, p.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("error loading certificate: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AbdKaan/httpfromtcp/internal/request"
+	"github.com/AbdKaan/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSigned writes a self-signed certificate for host to the files in
+// dir and returns their paths and the certificate.
+func writeSelfSigned(t *testing.T, dir, host string, serial int64) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, host+".crt")
+	keyFile := filepath.Join(dir, host+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, cert
+}
+
+// tlsGet makes a request over TLS and returns the connection state and
+// response.
+func tlsGet(t *testing.T, s *Server, serverName string, roots *x509.CertPool) (tls.ConnectionState, *response.Response) {
+	conn, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{
+		ServerName: serverName,
+		RootCAs:    roots,
+		NextProtos: []string{"http/1.1"},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + serverName + "\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := response.ResponseFromReader(bufio.NewReader(conn))
+	require.NoError(t, err)
+	return conn.ConnectionState(), resp
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey, a := writeSelfSigned(t, dir, "a.test", 1)
+	bCert, bKey, b := writeSelfSigned(t, dir, "b.test", 2)
+	roots := x509.NewCertPool()
+	roots.AddCert(a)
+	roots.AddCert(b)
+
+	certs := NewCertificates()
+	require.NoError(t, certs.Add(aCert, aKey))
+	require.NoError(t, certs.Add(bCert, bKey))
+	handler := func(w *response.Writer, req *request.Request) {
+		if !req.TLS {
+			writeError(w, response.StatusCodeSuccess, "plain")
+			return
+		}
+		writeError(w, response.StatusCodeSuccess, "secure")
+	}
+	s, err := ServeTLSConfig(handler, newListener(t), &tls.Config{GetCertificate: certs.GetCertificate})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Request over TLS with http/1.1 negotiated by ALPN
+	state, resp := tlsGet(t, s, "a.test", roots)
+	assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+	assert.Equal(t, "a.test", state.PeerCertificates[0].Subject.CommonName)
+	assert.Equal(t, response.StatusCodeSuccess, resp.StatusCode)
+	assert.Equal(t, "secure", string(resp.Body))
+
+	// Test: Certificate is picked by SNI
+	state, _ = tlsGet(t, s, "b.test", roots)
+	assert.Equal(t, "b.test", state.PeerCertificates[0].Subject.CommonName)
+
+	// Test: Unknown names get the first certificate
+	hello := &tls.ClientHelloInfo{ServerName: "other.test"}
+	cert, err := certs.GetCertificate(hello)
+	require.NoError(t, err)
+	assert.Equal(t, "a.test", cert.Leaf.Subject.CommonName)
+
+	// Test: Unsupported protocols in the config are not advertised
+	h2, err := ServeTLSConfig(handler, newListener(t), &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	})
+	require.NoError(t, err)
+	defer h2.Close()
+	conn, err := tls.Dial("tcp", h2.Addr().String(), &tls.Config{
+		ServerName: "a.test",
+		RootCAs:    roots,
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+	conn.Close()
+
+	// Test: Config without a certificate
+	_, err = ServeTLSConfig(handler, newListener(t), &tls.Config{})
+	require.Error(t, err)
+}
+
+func TestCertificateReload(t *testing.T) {
+	interval := certReloadInterval
+	certReloadInterval = 0
+	defer func() { certReloadInterval = interval }()
+
+	dir := t.TempDir()
+	certFile, keyFile, original := writeSelfSigned(t, dir, "a.test", 1)
+	s, err := ServeTLS(func(w *response.Writer, _ *request.Request) {
+		writeError(w, response.StatusCodeSuccess, "ok")
+	}, newListener(t), certFile, keyFile)
+	require.NoError(t, err)
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(original)
+	state, _ := tlsGet(t, s, "a.test", roots)
+	assert.Equal(t, int64(1), state.PeerCertificates[0].SerialNumber.Int64())
+
+	// Test: Replaced files are picked up by the next handshake
+	_, _, renewed := writeSelfSigned(t, dir, "a.test", 2)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	roots = x509.NewCertPool()
+	roots.AddCert(renewed)
+	state, _ = tlsGet(t, s, "a.test", roots)
+	assert.Equal(t, int64(2), state.PeerCertificates[0].SerialNumber.Int64())
+
+	// Test: Broken files keep the loaded certificate
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	state, _ = tlsGet(t, s, "a.test", roots)
+	assert.Equal(t, int64(2), state.PeerCertificates[0].SerialNumber.Int64())
+}